@@ -12,7 +12,9 @@ import (
 func main() {
 	utils.InitConfig()
 	utils.InitMySQL()
+	models.Migrate()
 	utils.InitRedis()
+	models.InitCluster()
 	// 初始化定时器
 	utils.Timer(time.Duration(viper.GetInt("timeout.DelayHeartbeat"))*time.Second, time.Duration(viper.GetInt("timeout.HeartbeatHz"))*time.Second, models.CleanConnection, "")
 	r := router.Router()
@@ -14,10 +14,17 @@ import (
 
 type Community struct {
 	gorm.Model
-	Name    string
-	OwnerId uint
-	Img     string
-	Desc    string
+	Name       string
+	OwnerId    uint
+	Img        string
+	Desc       string
+	JoinPolicy int  //入群方式  0直接加入 1需审核 2仅限邀请
+	AdminsOnly bool //全员禁言  仅群主和管理员可以发言
+}
+
+// 是否可以撤回群内他人的消息
+func canRecallOthers(userId int64, communityId int64) bool {
+	return HasGroupPerm(uint(userId), uint(communityId), PermRecall)
 }
 
 func CreateCommunity(community Community) (int, string) {
@@ -44,6 +51,7 @@ func CreateCommunity(community Community) (int, string) {
 	contact.OwnerId = community.OwnerId
 	contact.TargetId = community.ID
 	contact.Type = 2 //群关系
+	contact.Role = RoleOwner
 	if err := utils.DB.Create(&contact).Error; err != nil {
 		tx.Rollback()
 		return -1, "添加群关系失败"
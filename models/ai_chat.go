@@ -55,6 +55,7 @@ type AIChatRecord struct {
 	UserMessage string    `json:"user_message"`
 	AIReply     string    `json:"ai_reply"`
 	Timestamp   time.Time `json:"timestamp"`
+	Seq         int64     `json:"seq"` //会话内序号
 }
 
 // GetAIResponse 对外提供的AI响应函数
@@ -124,16 +125,76 @@ func RedisAIMsg(userID int64, start int64, end int64, isRev bool) []string {
 	return rels
 }
 
+// AIChatHistoryBySeq 按序号游标读取AI对话历史，before 为 true 时读取更早的记录
+func AIChatHistoryBySeq(userID int64, cursor int64, before bool, limit int) ([]AIChatRecord, int64, bool) {
+	ctx := context.Background()
+	chatKey := "ai_chat_" + strconv.Itoa(int(userID))
+
+	var records []redis.Z
+	var err error
+	if before {
+		max := "+inf"
+		if cursor > 0 {
+			max = "(" + strconv.FormatInt(cursor, 10)
+		}
+		records, err = utils.Red.ZRevRangeByScoreWithScores(ctx, chatKey, &redis.ZRangeBy{Min: "-inf", Max: max, Count: int64(limit) + 1}).Result()
+	} else {
+		min := "(" + strconv.FormatInt(cursor, 10)
+		records, err = utils.Red.ZRangeByScoreWithScores(ctx, chatKey, &redis.ZRangeBy{Min: min, Max: "+inf", Count: int64(limit) + 1}).Result()
+	}
+	if err != nil {
+		fmt.Println("获取AI对话历史失败:", err)
+		return []AIChatRecord{}, cursor, false
+	}
+
+	hasMore := len(records) > limit
+	if hasMore {
+		records = records[:limit]
+	}
+	chatHistory := make([]AIChatRecord, 0, len(records))
+	for _, z := range records {
+		var record AIChatRecord
+		recordStr, _ := z.Member.(string)
+		if err := json.Unmarshal([]byte(recordStr), &record); err == nil {
+			// 旧记录没有 Seq 字段，以 score 为准
+			record.Seq = int64(z.Score)
+			chatHistory = append(chatHistory, record)
+		}
+	}
+	// 游标取自 score，解析失败的记录也不会导致重复翻页
+	if n := len(records); n > 0 {
+		cursor = int64(records[n-1].Score)
+	}
+	return chatHistory, cursor, hasMore
+}
+
 // storeAIChatToRedis 将AI对话存储到Redis中
 func storeAIChatToRedis(userID int, userMessage, aiReply string) {
 	ctx := context.Background()
 	chatKey := "ai_chat_" + strconv.Itoa(userID)
 
+	// 分配严格递增的序号，作为有序集合的score
+	// 计数器不存在时从已有记录的最大score恢复，兼容旧的 len+1 写入方式
+	seqKey := "seq_" + chatKey
+	if n, err := utils.Red.Exists(ctx, seqKey).Result(); err == nil && n == 0 {
+		var maxSeq int64
+		if last, err := utils.Red.ZRevRangeWithScores(ctx, chatKey, 0, 0).Result(); err == nil && len(last) > 0 {
+			maxSeq = int64(last[0].Score)
+		}
+		utils.Red.SetNX(ctx, seqKey, maxSeq, 0)
+	}
+	seq, err := utils.Red.Incr(ctx, seqKey).Result()
+	if err != nil {
+		fmt.Println("Redis Incr error:", err)
+		return
+	}
+
 	// 创建对话记录
 	record := AIChatRecord{
 		UserMessage: userMessage,
 		AIReply:     aiReply,
 		Timestamp:   time.Now(),
+		Seq:         seq,
 	}
 
 	// 序列化为JSON
@@ -143,15 +204,8 @@ func storeAIChatToRedis(userID int, userMessage, aiReply string) {
 		return
 	}
 
-	// 获取当前对话列表长度，用作score
-	res, err := utils.Red.ZRevRange(ctx, chatKey, 0, -1).Result()
-	if err != nil {
-		fmt.Println("Redis ZRevRange error:", err)
-	}
-	score := float64(len(res)) + 1
-
 	// 存储到Redis有序集合
-	_, err = utils.Red.ZAdd(ctx, chatKey, &redis.Z{Score: score, Member: recordJSON}).Result()
+	_, err = utils.Red.ZAdd(ctx, chatKey, &redis.Z{Score: float64(seq), Member: recordJSON}).Result()
 	if err != nil {
 		fmt.Println("AI对话存储到Redis失败:", err)
 	} else {
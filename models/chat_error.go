@@ -0,0 +1,54 @@
+package models
+
+import (
+	"github.com/spf13/viper"
+)
+
+// 发送失败的原因，通过错误帧返回给发送者
+type ChatError struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (e *ChatError) Error() string {
+	return e.Code + ": " + e.Msg
+}
+
+var (
+	ErrBadFrame    = &ChatError{"bad_frame", "消息格式错误"}
+	ErrUnknownType = &ChatError{"unknown_type", "不支持的消息类型"}
+	ErrNotFriend   = &ChatError{"not_friend", "对方不是你的好友"}
+	ErrNotMember   = &ChatError{"not_member", "你不是该群成员"}
+	ErrBlocked     = &ChatError{"blocked", "消息已被对方拒收"}
+	ErrStoreFailed = &ChatError{"store_failed", "消息保存失败"}
+	ErrMuted       = &ChatError{"muted", "你已被禁言"}
+	ErrAdminsOnly  = &ChatError{"admins_only", "当前仅群主和管理员可以发言"}
+)
+
+// 私聊是否只允许发给好友，未配置时默认开启
+func friendOnly() bool {
+	if !viper.IsSet("chat.friendOnly") {
+		return true
+	}
+	return viper.GetBool("chat.friendOnly")
+}
+
+// 私聊发送权限校验
+func checkPrivateSend(userId int64, targetId int64) error {
+	if IsBlocked(uint(targetId), uint(userId)) {
+		return ErrBlocked
+	}
+	if friendOnly() && !IsFriend(uint(userId), uint(targetId)) {
+		return ErrNotFriend
+	}
+	return nil
+}
+
+// 群聊发送权限校验  成员身份、全员禁言和个人禁言
+func checkGroupSend(userId int64, groupId int64) error {
+	contact, community, role, ok := groupMembership(uint(userId), uint(groupId))
+	if !ok {
+		return ErrNotMember
+	}
+	return CheckGroupMute(contact, role, community)
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"simple-chatroom/utils"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+// 集群总线  负责实例之间的消息转发，可替换为其他实现（如 Redis Streams、MQ）
+type ClusterBus interface {
+	// 发送到指定实例，返回是否有实例接收
+	Publish(instanceId string, data []byte) (bool, error)
+	// 接收发往本实例的数据
+	Subscribe(instanceId string, handler func(data []byte))
+}
+
+// 跨实例转发的消息
+type clusterEnvelope struct {
+	UserId int64  `json:"user_id"`
+	Data   []byte `json:"data"`
+	Keep   bool   `json:"keep"`             //投递失败时是否存入离线收件箱
+	Except string `json:"except,omitempty"` //不投递的设备（发送消息的设备）
+}
+
+var (
+	clusterBus ClusterBus = redisBus{}
+	instanceId string
+)
+
+// 基于 Redis Pub/Sub 的集群总线，每个实例订阅自己的频道
+type redisBus struct{}
+
+func (redisBus) Publish(instanceId string, data []byte) (bool, error) {
+	n, err := utils.Red.Publish(context.Background(), instanceChannel(instanceId), data).Result()
+	return n > 0, err
+}
+
+func (redisBus) Subscribe(instanceId string, handler func(data []byte)) {
+	ch := utils.SubscribeChannel(context.Background(), instanceChannel(instanceId))
+	go func() {
+		for msg := range ch {
+			handler([]byte(msg.Payload))
+		}
+	}()
+}
+
+func instanceChannel(instanceId string) string {
+	return utils.PublishKey + "_node_" + instanceId
+}
+
+// 用户所在实例的路由表key
+func routeKey(userId int64) string {
+	return "route_" + strconv.FormatInt(userId, 10)
+}
+
+// 初始化集群：确定本实例ID并订阅发往本实例的消息
+func InitCluster() {
+	instanceId = viper.GetString("cluster.nodeId")
+	if instanceId == "" {
+		host, _ := os.Hostname()
+		instanceId = host + "_" + strconv.Itoa(os.Getpid())
+	}
+	clusterBus.Subscribe(instanceId, handleClusterMsg)
+	fmt.Println("cluster inited 。。。。", instanceId)
+}
+
+// 处理其他实例转发过来的消息，只投递给本实例上的连接
+func handleClusterMsg(data []byte) {
+	env := clusterEnvelope{}
+	if err := json.Unmarshal(data, &env); err != nil {
+		fmt.Println("集群消息解析失败:", err)
+		return
+	}
+	if !pushToLocalExcept(env.UserId, env.Except, env.Data) && env.Keep {
+		saveToInbox(env.UserId, env.Data)
+	}
+}
+
+// 登记用户连接在本实例上
+func addRoute(userId int64) {
+	utils.Red.SAdd(context.Background(), routeKey(userId), instanceId)
+}
+
+// 用户在本实例上已没有连接
+func delRoute(userId int64) {
+	utils.Red.SRem(context.Background(), routeKey(userId), instanceId)
+}
+
+// 是否还有实例持有该用户的连接
+func hasRoute(userId int64) bool {
+	n, err := utils.Red.SCard(context.Background(), routeKey(userId)).Result()
+	return err == nil && n > 0
+}
+
+// 转发给持有该用户连接的其他实例，返回是否有实例接收
+func routeToRemote(userId int64, msg []byte, keep bool) bool {
+	return publishRemote(clusterEnvelope{UserId: userId, Data: msg, Keep: keep})
+}
+
+// 把消息发布给持有该用户连接的其他实例
+func publishRemote(env clusterEnvelope) bool {
+	userId := env.UserId
+	instances, err := utils.Red.SMembers(context.Background(), routeKey(userId)).Result()
+	if err != nil {
+		fmt.Println("读取用户路由失败:", err)
+		return false
+	}
+	data, _ := json.Marshal(env)
+	routed := false
+	for _, id := range instances {
+		if id == instanceId {
+			continue
+		}
+		ok, err := clusterBus.Publish(id, data)
+		if err != nil {
+			fmt.Println("集群消息转发失败:", err)
+			continue
+		}
+		if ok {
+			routed = true
+		} else {
+			// 实例已下线，清理残留路由
+			utils.Red.SRem(context.Background(), routeKey(userId), id)
+		}
+	}
+	return routed
+}
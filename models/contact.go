@@ -7,6 +7,8 @@ package models
 
 import (
 	"simple-chatroom/utils"
+	"sort"
+	"strings"
 
 	"gorm.io/gorm"
 )
@@ -14,32 +16,146 @@ import (
 // 人员关系
 type Contact struct {
 	gorm.Model
-	OwnerId  uint //谁的关系信息
-	TargetId uint //对应的谁 /群 ID
-	Type     int  //对应的类型  1好友  2群  3xx
-	Desc     string
+	OwnerId     uint     //谁的关系信息
+	TargetId    uint     //对应的谁 /群 ID
+	Type        int      //对应的类型  1好友  2群  3拉黑
+	Desc        string   //好友备注名
+	Tags        []string `gorm:"serializer:json"` //好友分组标签
+	Starred     bool     //星标好友
+	Role        int      //群内角色  0成员 1管理员 2群主
+	MuteUntil   int64    //群内禁言截止时间（Unix秒）
+	NotifyMuted bool     //群消息免打扰
 }
 
 func (table *Contact) TableName() string {
 	return "contact"
 }
 
-func SearchFriend(userId uint) []UserBasic {
+// 好友信息  在用户信息上附带备注、标签和星标
+type Friend struct {
+	UserBasic
+	Remark  string
+	Tags    []string
+	Starred bool
+}
+
+// 好友列表排序方式
+const (
+	FriendSortDefault = ""       //星标在前，再按显示名
+	FriendSortName    = "name"   //按显示名（有备注时用备注）
+	FriendSortRecent  = "recent" //最近添加的在前
+)
+
+// 好友列表  tag 不为空时只返回带该标签的好友
+func SearchFriend(userId uint, sortBy string, tag string) []Friend {
 	contacts := make([]Contact, 0)
 	objIds := make([]uint64, 0)
-	utils.DB.Where("owner_id = ? and type=1", userId).Find(&contacts)
+	utils.DB.Where("owner_id = ? and type=1", userId).Order("id desc").Find(&contacts)
 	for _, v := range contacts {
 		objIds = append(objIds, uint64(v.TargetId))
 	}
 	users := make([]UserBasic, 0)
 	utils.DB.Where("id in ?", objIds).Find(&users)
-	return users
+	userMap := make(map[uint]UserBasic, len(users))
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+
+	friends := make([]Friend, 0, len(contacts))
+	for _, v := range contacts {
+		u, ok := userMap[v.TargetId]
+		if !ok || (tag != "" && !hasTag(v.Tags, tag)) {
+			continue
+		}
+		friends = append(friends, Friend{UserBasic: u, Remark: v.Desc, Tags: v.Tags, Starred: v.Starred})
+	}
+
+	switch sortBy {
+	case FriendSortRecent:
+		// 查询时已按添加时间倒序
+	case FriendSortName:
+		sort.SliceStable(friends, func(i, j int) bool {
+			return friends[i].DisplayName() < friends[j].DisplayName()
+		})
+	default:
+		sort.SliceStable(friends, func(i, j int) bool {
+			if friends[i].Starred != friends[j].Starred {
+				return friends[i].Starred
+			}
+			return friends[i].DisplayName() < friends[j].DisplayName()
+		})
+	}
+	return friends
 }
 
-// 添加好友   自己的ID  ， 好友的ID
-func AddFriend(userId uint, targetName string) (int, string) {
-	//user := UserBasic{}
+// 显示名  有备注时用备注
+func (f Friend) DisplayName() string {
+	if f.Remark != "" {
+		return f.Remark
+	}
+	return f.Name
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// 修改好友备注、标签和星标  参数为 nil 表示不修改
+func UpdateFriend(userId uint, targetId uint, remark *string, tags []string, starred *bool) (int, string) {
+	contact := Contact{}
+	utils.DB.Where("owner_id = ? and target_id = ? and type=1", userId, targetId).First(&contact)
+	if contact.ID == 0 {
+		return -1, "对方不是你的好友"
+	}
+	columns := make([]string, 0, 3)
+	if remark != nil {
+		contact.Desc = strings.TrimSpace(*remark)
+		columns = append(columns, "desc")
+	}
+	if tags != nil {
+		cleaned := make([]string, 0, len(tags))
+		for _, t := range tags {
+			if t = strings.TrimSpace(t); t != "" && !hasTag(cleaned, t) {
+				cleaned = append(cleaned, t)
+			}
+		}
+		contact.Tags = cleaned
+		columns = append(columns, "tags")
+	}
+	if starred != nil {
+		contact.Starred = *starred
+		columns = append(columns, "starred")
+	}
+	if len(columns) == 0 {
+		return -1, "没有需要修改的内容"
+	}
+	if err := utils.DB.Select(columns).Save(&contact).Error; err != nil {
+		return -1, "修改失败"
+	}
+	return 0, "修改成功"
+}
+
+// 好友标签及每个标签下的好友数
+func FriendTags(userId uint) map[string]int {
+	contacts := make([]Contact, 0)
+	utils.DB.Where("owner_id = ? and type=1", userId).Find(&contacts)
+	res := make(map[string]int)
+	for _, v := range contacts {
+		for _, t := range v.Tags {
+			res[t]++
+		}
+	}
+	return res
+}
 
+// 添加好友   自己的ID  ， 好友的ID
+// 发起好友申请，对方同意后才建立好友关系；对方已向自己发起申请时直接通过
+func AddFriend(userId uint, targetName string, greeting string) (int, string) {
 	if targetName != "" {
 		targetUser := FindUserByName(targetName)
 		//fmt.Println(targetUser, " userId        ", )
@@ -47,42 +163,47 @@ func AddFriend(userId uint, targetName string) (int, string) {
 			if targetUser.ID == userId {
 				return -1, "不能加自己"
 			}
-			contact0 := Contact{}
-			utils.DB.Where("owner_id =?  and target_id =? and type=1", userId, targetUser.ID).Find(&contact0)
-			if contact0.ID != 0 {
+			if IsFriend(userId, targetUser.ID) {
 				return -1, "不能重复添加"
 			}
-			tx := utils.DB.Begin()
-			//事务一旦开始，不论什么异常最终都会 Rollback
-			defer func() {
-				if r := recover(); r != nil {
-					tx.Rollback()
-				}
-			}()
-			contact := Contact{}
-			contact.OwnerId = userId
-			contact.TargetId = targetUser.ID
-			contact.Type = 1
-			if err := utils.DB.Create(&contact).Error; err != nil {
-				tx.Rollback()
-				return -1, "添加好友失败"
-			}
-			contact1 := Contact{}
-			contact1.OwnerId = targetUser.ID
-			contact1.TargetId = userId
-			contact1.Type = 1
-			if err := utils.DB.Create(&contact1).Error; err != nil {
-				tx.Rollback()
-				return -1, "添加好友失败"
+			if IsBlocked(targetUser.ID, userId) {
+				return -1, "对方拒绝添加好友"
 			}
-			tx.Commit()
-			return 0, "添加好友成功"
+			return SendFriendRequest(userId, targetUser.ID, greeting)
 		}
 		return -1, "没有找到此用户"
 	}
 	return -1, "好友ID不能为空"
 }
 
+// 建立双向好友关系
+func makeFriends(userId uint, targetId uint) error {
+	tx := utils.DB.Begin()
+	//事务一旦开始，不论什么异常最终都会 Rollback
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+	contact := Contact{}
+	contact.OwnerId = userId
+	contact.TargetId = targetId
+	contact.Type = 1
+	if err := tx.Create(&contact).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	contact1 := Contact{}
+	contact1.OwnerId = targetId
+	contact1.TargetId = userId
+	contact1.Type = 1
+	if err := tx.Create(&contact1).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
 func SearchUserByGroupId(communityId uint) []uint {
 	contacts := make([]Contact, 0)
 	objIds := make([]uint, 0)
@@ -92,3 +213,111 @@ func SearchUserByGroupId(communityId uint) []uint {
 	}
 	return objIds
 }
+
+// 删除好友  双向移除
+func DeleteFriend(userId uint, targetId uint) (int, string) {
+	if !IsFriend(userId, targetId) {
+		return -1, "对方不是你的好友"
+	}
+	err := utils.DB.Where("((owner_id = ? and target_id = ?) or (owner_id = ? and target_id = ?)) and type=1",
+		userId, targetId, targetId, userId).Delete(&Contact{}).Error
+	if err != nil {
+		return -1, "删除好友失败"
+	}
+	return 0, "删除好友成功"
+}
+
+// 拉黑用户
+func BlockUser(userId uint, targetId uint) (int, string) {
+	if userId == targetId {
+		return -1, "不能拉黑自己"
+	}
+	if FindByID(targetId).ID == 0 {
+		return -1, "没有找到此用户"
+	}
+	if IsBlocked(userId, targetId) {
+		return -1, "已拉黑此用户"
+	}
+	contact := Contact{OwnerId: userId, TargetId: targetId, Type: 3}
+	if err := utils.DB.Create(&contact).Error; err != nil {
+		return -1, "拉黑失败"
+	}
+	closeFriendRequests(userId, targetId)
+	return 0, "拉黑成功"
+}
+
+// 取消拉黑
+func UnblockUser(userId uint, targetId uint) (int, string) {
+	res := utils.DB.Where("owner_id = ? and target_id = ? and type=3", userId, targetId).Delete(&Contact{})
+	if res.Error != nil {
+		return -1, "取消拉黑失败"
+	}
+	if res.RowsAffected == 0 {
+		return -1, "未拉黑此用户"
+	}
+	return 0, "已取消拉黑"
+}
+
+// 黑名单
+func BlockList(userId uint) []UserBasic {
+	ids := make([]uint, 0)
+	utils.DB.Model(&Contact{}).Where("owner_id = ? and type=3", userId).Pluck("target_id", &ids)
+	users := make([]UserBasic, 0)
+	if len(ids) > 0 {
+		utils.DB.Where("id in ?", ids).Find(&users)
+	}
+	return users
+}
+
+// userId 是否拉黑了 targetId
+func IsBlocked(userId uint, targetId uint) bool {
+	var count int64
+	utils.DB.Model(&Contact{}).Where("owner_id = ? and target_id = ? and type=3", userId, targetId).Count(&count)
+	return count > 0
+}
+
+// userId 拉黑的用户
+func blockedIds(userId uint) map[uint]bool {
+	res := make(map[uint]bool)
+	ids := make([]uint, 0)
+	utils.DB.Model(&Contact{}).Where("owner_id = ? and type=3", userId).Pluck("target_id", &ids)
+	for _, id := range ids {
+		res[id] = true
+	}
+	return res
+}
+
+// 在 userIds 中拉黑了 targetId 的用户
+func blockedBy(targetId uint, userIds []uint) map[uint]bool {
+	res := make(map[uint]bool)
+	if len(userIds) == 0 {
+		return res
+	}
+	ids := make([]uint, 0)
+	utils.DB.Model(&Contact{}).Where("owner_id in ? and target_id = ? and type=3", userIds, targetId).Pluck("owner_id", &ids)
+	for _, id := range ids {
+		res[id] = true
+	}
+	return res
+}
+
+// 好友ID列表
+func friendIds(userId uint) []uint {
+	ids := make([]uint, 0)
+	utils.DB.Model(&Contact{}).Where("owner_id = ? and type=1", userId).Pluck("target_id", &ids)
+	return ids
+}
+
+// 是否为好友
+func IsFriend(userId uint, targetId uint) bool {
+	var count int64
+	utils.DB.Model(&Contact{}).Where("owner_id = ? and target_id = ? and type=1", userId, targetId).Count(&count)
+	return count > 0
+}
+
+// 是否为群成员
+func IsGroupMember(userId uint, communityId uint) bool {
+	var count int64
+	utils.DB.Model(&Contact{}).Where("owner_id = ? and target_id = ? and type=2", userId, communityId).Count(&count)
+	return count > 0
+}
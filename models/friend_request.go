@@ -0,0 +1,184 @@
+package models
+
+import (
+	"simple-chatroom/utils"
+	"time"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 好友申请
+type FriendRequest struct {
+	gorm.Model
+	FromId     uint   `gorm:"index"` //申请人
+	ToId       uint   `gorm:"index"` //被申请人
+	Greeting   string //招呼语
+	Status     int    //状态  0待处理 1已同意 2已拒绝 3已撤回 4已过期
+	ExpireTime time.Time
+	HandleTime *time.Time
+}
+
+func (table *FriendRequest) TableName() string {
+	return "friend_request"
+}
+
+// 好友申请状态
+const (
+	FriendRequestPending   = 0
+	FriendRequestAccepted  = 1
+	FriendRequestRejected  = 2
+	FriendRequestCancelled = 3
+	FriendRequestExpired   = 4
+)
+
+// 好友申请有效期  单位H
+func friendRequestTTL() time.Duration {
+	h := viper.GetInt("timeout.FriendRequestTime")
+	if h <= 0 {
+		h = 72
+	}
+	return time.Duration(h) * time.Hour
+}
+
+// 把已过期的待处理申请标记为过期
+func expireFriendRequests(userId uint) {
+	utils.DB.Model(&FriendRequest{}).
+		Where("(from_id = ? or to_id = ?) and status = ? and expire_time < ?", userId, userId, FriendRequestPending, time.Now()).
+		Update("status", FriendRequestExpired)
+}
+
+// 查找待处理的申请
+func pendingFriendRequest(fromId uint, toId uint) FriendRequest {
+	req := FriendRequest{}
+	utils.DB.Where("from_id = ? and to_id = ? and status = ? and expire_time >= ?", fromId, toId, FriendRequestPending, time.Now()).
+		Last(&req)
+	return req
+}
+
+// 发起好友申请
+func SendFriendRequest(fromId uint, toId uint, greeting string) (int, string) {
+	// 对方已经向自己发起过申请，直接通过
+	if reverse := pendingFriendRequest(toId, fromId); reverse.ID != 0 {
+		return AcceptFriendRequest(fromId, reverse.ID)
+	}
+	if req := pendingFriendRequest(fromId, toId); req.ID != 0 {
+		return -1, "已发送过申请，请等待对方处理"
+	}
+	req := FriendRequest{
+		FromId:     fromId,
+		ToId:       toId,
+		Greeting:   greeting,
+		Status:     FriendRequestPending,
+		ExpireTime: time.Now().Add(friendRequestTTL()),
+	}
+	if err := utils.DB.Create(&req).Error; err != nil {
+		return -1, "发送好友申请失败"
+	}
+	notifyFriendRequest(&req, toId)
+	return 0, "好友申请已发送"
+}
+
+// 处理申请前的校验：只有对应的一方可以处理待处理且未过期的申请
+func findHandleableRequest(requestId uint, userId uint, asReceiver bool) (*FriendRequest, string) {
+	req := FriendRequest{}
+	utils.DB.Where("id = ?", requestId).First(&req)
+	if req.ID == 0 {
+		return nil, "好友申请不存在"
+	}
+	if (asReceiver && req.ToId != userId) || (!asReceiver && req.FromId != userId) {
+		return nil, "没有权限"
+	}
+	if req.Status != FriendRequestPending {
+		return nil, "好友申请已处理"
+	}
+	if req.ExpireTime.Before(time.Now()) {
+		utils.DB.Model(&req).Update("status", FriendRequestExpired)
+		return nil, "好友申请已过期"
+	}
+	return &req, ""
+}
+
+// 更新申请状态，并通知另一方
+func finishFriendRequest(req *FriendRequest, status int, notifyId uint) {
+	now := time.Now()
+	req.Status = status
+	req.HandleTime = &now
+	utils.DB.Model(req).Updates(map[string]interface{}{"status": status, "handle_time": now})
+	notifyFriendRequest(req, notifyId)
+}
+
+// 拉黑后关闭双方之间待处理的申请：对方发来的记为拒绝，自己发出的记为撤回
+// 不推送事件，避免对方感知被拉黑
+func closeFriendRequests(userId uint, targetId uint) {
+	now := time.Now()
+	utils.DB.Model(&FriendRequest{}).Where("from_id = ? and to_id = ? and status = ?", targetId, userId, FriendRequestPending).
+		Updates(map[string]interface{}{"status": FriendRequestRejected, "handle_time": now})
+	utils.DB.Model(&FriendRequest{}).Where("from_id = ? and to_id = ? and status = ?", userId, targetId, FriendRequestPending).
+		Updates(map[string]interface{}{"status": FriendRequestCancelled, "handle_time": now})
+}
+
+// 同意好友申请
+func AcceptFriendRequest(userId uint, requestId uint) (int, string) {
+	req, msg := findHandleableRequest(requestId, userId, true)
+	if req == nil {
+		return -1, msg
+	}
+	if IsBlocked(req.ToId, req.FromId) || IsBlocked(req.FromId, req.ToId) {
+		return -1, "无法添加该用户为好友"
+	}
+	if !IsFriend(req.ToId, req.FromId) {
+		if err := makeFriends(req.ToId, req.FromId); err != nil {
+			return -1, "添加好友失败"
+		}
+	}
+	finishFriendRequest(req, FriendRequestAccepted, req.FromId)
+	return 0, "添加好友成功"
+}
+
+// 拒绝好友申请
+func RejectFriendRequest(userId uint, requestId uint) (int, string) {
+	req, msg := findHandleableRequest(requestId, userId, true)
+	if req == nil {
+		return -1, msg
+	}
+	finishFriendRequest(req, FriendRequestRejected, req.FromId)
+	return 0, "已拒绝"
+}
+
+// 撤回自己发出的好友申请
+func CancelFriendRequest(userId uint, requestId uint) (int, string) {
+	req, msg := findHandleableRequest(requestId, userId, false)
+	if req == nil {
+		return -1, msg
+	}
+	finishFriendRequest(req, FriendRequestCancelled, req.ToId)
+	return 0, "已撤回"
+}
+
+// 收到的（incoming=true）或发出的好友申请
+func ListFriendRequests(userId uint, incoming bool) []FriendRequest {
+	expireFriendRequests(userId)
+	reqs := make([]FriendRequest, 0)
+	column := "from_id"
+	if incoming {
+		column = "to_id"
+	}
+	utils.DB.Where(column+" = ?", userId).Order("id desc").Find(&reqs)
+	return reqs
+}
+
+// 推送好友申请事件  Amount 为申请当前状态
+func notifyFriendRequest(req *FriendRequest, userId uint) {
+	event := Message{
+		UserId:     int64(req.FromId),
+		TargetId:   int64(req.ToId),
+		Type:       MsgTypeFriendRequest,
+		Content:    req.Greeting,
+		Amount:     req.Status,
+		MsgId:      req.ID,
+		CreateTime: uint64(time.Now().Unix()),
+	}
+	data, _ := event.MarshalBinary()
+	sendMsgToUser(int64(userId), data)
+}
@@ -0,0 +1,330 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"simple-chatroom/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 入群方式
+const (
+	JoinPolicyOpen     = 0 //任何人可直接加入
+	JoinPolicyApproval = 1 //需要管理员审核
+	JoinPolicyInvite   = 2 //仅限邀请
+)
+
+// 入群申请
+type GroupJoinRequest struct {
+	gorm.Model
+	CommunityId uint `gorm:"index"`
+	UserId      uint `gorm:"index"` //申请人
+	Reason      string
+	Status      int  //状态  0待处理 1已同意 2已拒绝 3已撤回
+	HandlerId   uint //处理人
+	HandleTime  *time.Time
+}
+
+func (table *GroupJoinRequest) TableName() string {
+	return "group_join_request"
+}
+
+// 入群申请状态
+const (
+	JoinRequestPending   = 0
+	JoinRequestAccepted  = 1
+	JoinRequestRejected  = 2
+	JoinRequestCancelled = 3
+)
+
+// 入群邀请码
+type GroupInvite struct {
+	gorm.Model
+	CommunityId uint       `gorm:"index"`
+	CreatorId   uint       //创建人
+	Code        string     `gorm:"uniqueIndex;size:32"`
+	ExpireTime  *time.Time //为空表示永久有效
+	MaxUses     int        //最多可用次数  0不限
+	Uses        int        //已使用次数
+	Revoked     bool       //已作废
+}
+
+func (table *GroupInvite) TableName() string {
+	return "group_invite"
+}
+
+// 加入群  成员记录已存在时视为成功
+func addGroupMember(userId uint, communityId uint) error {
+	if IsGroupMember(userId, communityId) {
+		return nil
+	}
+	if isGroupBanned(userId, communityId) {
+		return errGroupBanned
+	}
+	contact := Contact{OwnerId: userId, TargetId: communityId, Type: 2, Role: RoleMember}
+	return utils.DB.Create(&contact).Error
+}
+
+// 群主和管理员
+func groupAdminIds(communityId uint) []uint {
+	community := Community{}
+	utils.DB.Where("id = ?", communityId).First(&community)
+	ids := make([]uint, 0)
+	utils.DB.Model(&Contact{}).Where("target_id = ? and type=2 and role in ? and owner_id <> ?", communityId, []int{RoleAdmin, RoleOwner}, community.OwnerId).
+		Pluck("owner_id", &ids)
+	if community.OwnerId != 0 {
+		ids = append(ids, community.OwnerId)
+	}
+	return ids
+}
+
+// 设置入群方式
+func SetJoinPolicy(operatorId uint, communityId uint, policy int) (int, string) {
+	if policy < JoinPolicyOpen || policy > JoinPolicyInvite {
+		return -1, "不支持的入群方式"
+	}
+	if !HasGroupPerm(operatorId, communityId, PermRename) {
+		return -1, "没有操作权限"
+	}
+	if err := utils.DB.Model(&Community{}).Where("id = ?", communityId).Update("join_policy", policy).Error; err != nil {
+		return -1, "设置失败"
+	}
+	return 0, "设置成功"
+}
+
+// 申请加入群  按群的入群方式直接加入或进入审核队列
+func JoinGroup(userId uint, comId string, reason string) (int, string) {
+	community := Community{}
+	utils.DB.Where("id=? or name=?", comId, comId).Find(&community)
+	if community.Name == "" {
+		return -1, "没有找到群"
+	}
+	if IsGroupMember(userId, community.ID) {
+		return -1, "已加过此群"
+	}
+	if isGroupBanned(userId, community.ID) {
+		return -1, "你已被移出该群，不能再加入"
+	}
+	switch community.JoinPolicy {
+	case JoinPolicyOpen:
+		if err := addGroupMember(userId, community.ID); err != nil {
+			return -1, "加群失败"
+		}
+		return 0, "加群成功"
+	case JoinPolicyApproval:
+		return sendJoinRequest(userId, community.ID, reason)
+	default:
+		return -1, "该群仅限邀请加入"
+	}
+}
+
+// 提交入群申请并通知管理员
+func sendJoinRequest(userId uint, communityId uint, reason string) (int, string) {
+	req := GroupJoinRequest{}
+	utils.DB.Where("community_id = ? and user_id = ? and status = ?", communityId, userId, JoinRequestPending).Last(&req)
+	if req.ID != 0 {
+		return -1, "已提交过申请，请等待管理员审核"
+	}
+	req = GroupJoinRequest{CommunityId: communityId, UserId: userId, Reason: reason, Status: JoinRequestPending}
+	if err := utils.DB.Create(&req).Error; err != nil {
+		return -1, "提交申请失败"
+	}
+	for _, id := range groupAdminIds(communityId) {
+		notifyJoinRequest(&req, id)
+	}
+	return 0, "已提交申请，等待管理员审核"
+}
+
+// 处理入群申请  同意或拒绝
+func HandleJoinRequest(operatorId uint, requestId uint, accept bool) (int, string) {
+	req := GroupJoinRequest{}
+	utils.DB.Where("id = ?", requestId).First(&req)
+	if req.ID == 0 {
+		return -1, "入群申请不存在"
+	}
+	if !isGroupAdmin(operatorId, req.CommunityId) {
+		return -1, "没有操作权限"
+	}
+	status := JoinRequestRejected
+	if accept {
+		status = JoinRequestAccepted
+	}
+	now := time.Now()
+	// 多个管理员同时处理时只有一个生效
+	res := utils.DB.Model(&GroupJoinRequest{}).Where("id = ? and status = ?", req.ID, JoinRequestPending).
+		Updates(map[string]interface{}{"status": status, "handler_id": operatorId, "handle_time": now})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return -1, "入群申请已处理"
+	}
+	if accept {
+		if err := addGroupMember(req.UserId, req.CommunityId); err != nil {
+			utils.DB.Model(&GroupJoinRequest{}).Where("id = ?", req.ID).
+				Updates(map[string]interface{}{"status": JoinRequestPending, "handler_id": 0, "handle_time": nil})
+			return -1, "加群失败"
+		}
+	}
+	req.Status, req.HandlerId, req.HandleTime = status, operatorId, &now
+	notifyJoinRequest(&req, req.UserId)
+	for _, id := range groupAdminIds(req.CommunityId) {
+		if id != operatorId {
+			notifyJoinRequest(&req, id)
+		}
+	}
+	if accept {
+		return 0, "已同意"
+	}
+	return 0, "已拒绝"
+}
+
+// 撤回自己的入群申请
+func CancelJoinRequest(userId uint, requestId uint) (int, string) {
+	req := GroupJoinRequest{}
+	utils.DB.Where("id = ? and user_id = ?", requestId, userId).First(&req)
+	if req.ID == 0 {
+		return -1, "入群申请不存在"
+	}
+	res := utils.DB.Model(&GroupJoinRequest{}).Where("id = ? and status = ?", req.ID, JoinRequestPending).
+		Update("status", JoinRequestCancelled)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return -1, "入群申请已处理"
+	}
+	req.Status = JoinRequestCancelled
+	for _, id := range groupAdminIds(req.CommunityId) {
+		notifyJoinRequest(&req, id)
+	}
+	return 0, "已撤回"
+}
+
+// 群的待审核申请  仅管理员可见
+func PendingJoinRequests(operatorId uint, communityId uint) ([]GroupJoinRequest, string) {
+	if !isGroupAdmin(operatorId, communityId) {
+		return nil, "没有操作权限"
+	}
+	reqs := make([]GroupJoinRequest, 0)
+	utils.DB.Where("community_id = ? and status = ?", communityId, JoinRequestPending).Order("id asc").Find(&reqs)
+	return reqs, "查询成功"
+}
+
+// 是否为群主或管理员
+func isGroupAdmin(userId uint, communityId uint) bool {
+	role, ok := groupRole(userId, communityId)
+	return ok && role >= RoleAdmin
+}
+
+// 生成邀请码  expireHours 为 0 表示永久有效，maxUses 为 0 表示不限次数
+func CreateGroupInvite(operatorId uint, communityId uint, expireHours int, maxUses int) (*GroupInvite, string) {
+	if !HasGroupPerm(operatorId, communityId, PermInvite) {
+		return nil, "没有操作权限"
+	}
+	if expireHours < 0 || maxUses < 0 {
+		return nil, "参数错误"
+	}
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "生成邀请码失败"
+	}
+	invite := GroupInvite{CommunityId: communityId, CreatorId: operatorId, Code: hex.EncodeToString(buf), MaxUses: maxUses}
+	if expireHours > 0 {
+		t := time.Now().Add(time.Duration(expireHours) * time.Hour)
+		invite.ExpireTime = &t
+	}
+	if err := utils.DB.Create(&invite).Error; err != nil {
+		return nil, "生成邀请码失败"
+	}
+	return &invite, "生成成功"
+}
+
+// 作废邀请码  创建人或管理员可以操作
+func RevokeGroupInvite(operatorId uint, code string) (int, string) {
+	invite := GroupInvite{}
+	utils.DB.Where("code = ?", code).First(&invite)
+	if invite.ID == 0 {
+		return -1, "邀请码不存在"
+	}
+	if invite.CreatorId != operatorId && !isGroupAdmin(operatorId, invite.CommunityId) {
+		return -1, "没有操作权限"
+	}
+	utils.DB.Model(&invite).Update("revoked", true)
+	return 0, "已作废"
+}
+
+// 群的有效邀请码
+func GroupInvites(operatorId uint, communityId uint) ([]GroupInvite, string) {
+	if !IsGroupMember(operatorId, communityId) {
+		return nil, "你不是该群成员"
+	}
+	invites := make([]GroupInvite, 0)
+	query := utils.DB.Where("community_id = ? and revoked = ? and (expire_time is null or expire_time > ?)", communityId, false, time.Now())
+	if !isGroupAdmin(operatorId, communityId) {
+		query = query.Where("creator_id = ?", operatorId)
+	}
+	query.Order("id desc").Find(&invites)
+	return invites, "查询成功"
+}
+
+// 通过邀请码入群  仅限邀请的群也可加入，需审核的群里普通成员创建的邀请码进入审核队列
+func JoinByInvite(userId uint, code string) (int, string) {
+	invite := GroupInvite{}
+	utils.DB.Where("code = ?", code).First(&invite)
+	if invite.ID == 0 || invite.Revoked {
+		return -1, "邀请码无效"
+	}
+	if invite.ExpireTime != nil && invite.ExpireTime.Before(time.Now()) {
+		return -1, "邀请码已过期"
+	}
+	if IsGroupMember(userId, invite.CommunityId) {
+		return -1, "已加过此群"
+	}
+	if isGroupBanned(userId, invite.CommunityId) {
+		return -1, "你已被移出该群，不能再加入"
+	}
+	// 创建人已退群或失去邀请权限时邀请码失效
+	if !HasGroupPerm(invite.CreatorId, invite.CommunityId, PermInvite) {
+		return -1, "邀请码无效"
+	}
+	// 需审核的群里普通成员的邀请码与直接邀请一致，进入审核队列
+	community := Community{}
+	utils.DB.Where("id = ?", invite.CommunityId).First(&community)
+	needApproval := community.JoinPolicy == JoinPolicyApproval && !isGroupAdmin(invite.CreatorId, invite.CommunityId)
+	if needApproval {
+		req := GroupJoinRequest{}
+		utils.DB.Where("community_id = ? and user_id = ? and status = ?", invite.CommunityId, userId, JoinRequestPending).Last(&req)
+		if req.ID != 0 {
+			return -1, "已提交过申请，请等待管理员审核"
+		}
+	}
+	// 条件更新占用一次次数，避免并发超出上限
+	res := utils.DB.Model(&GroupInvite{}).Where("id = ? and (max_uses = 0 or uses < max_uses)", invite.ID).
+		Update("uses", gorm.Expr("uses + 1"))
+	if res.Error != nil || res.RowsAffected == 0 {
+		return -1, "邀请码已达使用上限"
+	}
+	ret, msg := 0, "加群成功"
+	if needApproval {
+		ret, msg = sendJoinRequest(userId, invite.CommunityId, "通过 "+FindByID(invite.CreatorId).Name+" 的邀请码申请入群")
+	} else if err := addGroupMember(userId, invite.CommunityId); err != nil {
+		ret, msg = -1, "加群失败"
+	}
+	// 入群失败时归还占用的次数
+	if ret != 0 {
+		utils.DB.Model(&GroupInvite{}).Where("id = ? and uses > 0", invite.ID).Update("uses", gorm.Expr("uses - 1"))
+	}
+	return ret, msg
+}
+
+// 推送入群申请事件  TargetId 为群，Amount 为申请当前状态
+func notifyJoinRequest(req *GroupJoinRequest, userId uint) {
+	event := Message{
+		UserId:     int64(req.UserId),
+		TargetId:   int64(req.CommunityId),
+		Type:       MsgTypeGroupJoin,
+		Content:    req.Reason,
+		Amount:     req.Status,
+		MsgId:      req.ID,
+		CreateTime: uint64(time.Now().Unix()),
+	}
+	data, _ := event.MarshalBinary()
+	sendMsgToUser(int64(userId), data)
+}
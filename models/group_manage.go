@@ -0,0 +1,203 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"simple-chatroom/utils"
+
+	"gorm.io/gorm"
+)
+
+// 群黑名单  被移出并拉黑的用户不能再加入
+type GroupBan struct {
+	gorm.Model
+	CommunityId uint `gorm:"index"`
+	UserId      uint `gorm:"index"`
+	OperatorId  uint //操作人
+}
+
+func (table *GroupBan) TableName() string {
+	return "group_ban"
+}
+
+// 群系统消息事件  放在 Desc 中，Media 为 MediaSystem
+const (
+	GroupEventLeave      = "leave"
+	GroupEventKick       = "kick"
+	GroupEventTransfer   = "transfer"
+	GroupEventDisband    = "disband"
+	GroupEventMute       = "mute"
+	GroupEventAdminsOnly = "adminsOnly"
+)
+
+var errGroupBanned = errors.New("group banned")
+
+// 是否在群黑名单中
+func isGroupBanned(userId uint, communityId uint) bool {
+	var count int64
+	utils.DB.Model(&GroupBan{}).Where("community_id = ? and user_id = ?", communityId, userId).Count(&count)
+	return count > 0
+}
+
+// 在群时间线中写入系统消息并推送给群成员  extra 为额外需要通知的用户（如刚离开的成员）
+func postGroupSystemMsg(communityId uint, operatorId uint, event string, content string, extra ...uint) {
+	msg := &Message{
+		UserId:   int64(operatorId),
+		TargetId: int64(communityId),
+		Type:     MsgTypeGroup,
+		Media:    MediaSystem,
+		Content:  content,
+		Desc:     event,
+	}
+	ctx := context.Background()
+	if err := storeMessage(ctx, groupMsgKey(msg.TargetId), groupMsgQuery(msg.TargetId), msg); err != nil {
+		return
+	}
+	data, _ := msg.MarshalBinary()
+	for _, id := range append(SearchUserByGroupId(communityId), extra...) {
+		sendMsgToUser(int64(id), data)
+	}
+}
+
+// 移出群  删除成员关系和已读进度
+func removeGroupMember(userId uint, communityId uint) error {
+	err := utils.DB.Where("owner_id = ? and target_id = ? and type=2", userId, communityId).Delete(&Contact{}).Error
+	if err != nil {
+		return err
+	}
+	utils.DB.Where("user_id = ? and type = ? and target_id = ?", userId, MsgTypeGroup, communityId).Delete(&ReadCursor{})
+	return nil
+}
+
+// 退出群  群主需要先转让群或解散群
+func LeaveGroup(userId uint, communityId uint) (int, string) {
+	role, ok := groupRole(userId, communityId)
+	if !ok {
+		return -1, "你不是该群成员"
+	}
+	if role == RoleOwner {
+		return -1, "群主不能退群，请先转让群主或解散群"
+	}
+	if err := removeGroupMember(userId, communityId); err != nil {
+		return -1, "退群失败"
+	}
+	postGroupSystemMsg(communityId, userId, GroupEventLeave, FindByID(userId).Name+" 退出了群聊", userId)
+	return 0, "退群成功"
+}
+
+// 移除群成员  ban 为 true 时同时加入群黑名单
+func KickFromGroup(operatorId uint, communityId uint, targetId uint, ban bool) (int, string) {
+	if code, msg := canManage(operatorId, targetId, communityId, PermKick); code != 0 {
+		return code, msg
+	}
+	if err := removeGroupMember(targetId, communityId); err != nil {
+		return -1, "移除失败"
+	}
+	if ban && !isGroupBanned(targetId, communityId) {
+		utils.DB.Create(&GroupBan{CommunityId: communityId, UserId: targetId, OperatorId: operatorId})
+	}
+	postGroupSystemMsg(communityId, operatorId, GroupEventKick,
+		FindByID(targetId).Name+" 被 "+FindByID(operatorId).Name+" 移出了群聊", targetId)
+	return 0, "移除成功"
+}
+
+// 解除群黑名单
+func UnbanGroupMember(operatorId uint, communityId uint, targetId uint) (int, string) {
+	if !HasGroupPerm(operatorId, communityId, PermKick) {
+		return -1, "没有操作权限"
+	}
+	res := utils.DB.Where("community_id = ? and user_id = ?", communityId, targetId).Delete(&GroupBan{})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return -1, "对方不在群黑名单中"
+	}
+	return 0, "已解除"
+}
+
+// 群黑名单列表
+func GroupBans(operatorId uint, communityId uint) ([]GroupBan, string) {
+	if !HasGroupPerm(operatorId, communityId, PermKick) {
+		return nil, "没有操作权限"
+	}
+	bans := make([]GroupBan, 0)
+	utils.DB.Where("community_id = ?", communityId).Order("id desc").Find(&bans)
+	return bans, "查询成功"
+}
+
+// 转让群主  原群主成为管理员
+func TransferGroup(operatorId uint, communityId uint, targetId uint) (int, string) {
+	role, ok := groupRole(operatorId, communityId)
+	if !ok || role != RoleOwner {
+		return -1, "只有群主可以转让群"
+	}
+	if operatorId == targetId {
+		return -1, "不能转让给自己"
+	}
+	if !IsGroupMember(targetId, communityId) {
+		return -1, "对方不是该群成员"
+	}
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Community{}).Where("id = ? and owner_id = ?", communityId, operatorId).
+			Update("owner_id", targetId).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Contact{}).Where("owner_id = ? and target_id = ? and type=2", targetId, communityId).
+			Update("role", RoleOwner).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Contact{}).Where("owner_id = ? and target_id = ? and type=2", operatorId, communityId).
+			Update("role", RoleAdmin).Error
+	})
+	if err != nil {
+		fmt.Println("转让群主失败:", err)
+		return -1, "转让失败"
+	}
+	postGroupSystemMsg(communityId, operatorId, GroupEventTransfer,
+		FindByID(operatorId).Name+" 将群主转让给了 "+FindByID(targetId).Name)
+	return 0, "转让成功"
+}
+
+// 解散群  只有群主可以操作，清理成员关系、申请、邀请码、公告、置顶和Redis中的群消息缓存
+func DisbandGroup(operatorId uint, communityId uint) (int, string) {
+	role, ok := groupRole(operatorId, communityId)
+	if !ok || role != RoleOwner {
+		return -1, "只有群主可以解散群"
+	}
+	memberIds := SearchUserByGroupId(communityId)
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("target_id = ? and type=2", communityId).Delete(&Contact{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("type = ? and target_id = ?", MsgTypeGroup, communityId).Delete(&ReadCursor{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&GroupJoinRequest{}).Where("community_id = ? and status = ?", communityId, JoinRequestPending).
+			Update("status", JoinRequestRejected).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&GroupInvite{}).Where("community_id = ?", communityId).Update("revoked", true).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("community_id = ?", communityId).Delete(&GroupBan{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("community_id = ?", communityId).Delete(&GroupPin{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("community_id = ?", communityId).Delete(&GroupAnnouncement{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", communityId).Delete(&Community{}).Error
+	})
+	if err != nil {
+		fmt.Println("解散群失败:", err)
+		return -1, "解散失败"
+	}
+	// 成员关系已删除，系统消息直接推给原成员
+	postGroupSystemMsg(communityId, operatorId, GroupEventDisband, "群主解散了本群", memberIds...)
+	key := groupMsgKey(int64(communityId))
+	if err := utils.Red.Del(context.Background(), key, "seq_"+key).Err(); err != nil {
+		fmt.Println("清理群消息缓存失败:", err)
+	}
+	return 0, "解散成功"
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"simple-chatroom/utils"
+	"strings"
+)
+
+// 群成员角色
+const (
+	RoleMember = 0 //普通成员
+	RoleAdmin  = 1 //管理员
+	RoleOwner  = 2 //群主
+)
+
+// 群管理权限
+type GroupPerm int
+
+const (
+	PermRename   GroupPerm = iota + 1 //修改群名称/头像/简介
+	PermInvite                        //邀请成员
+	PermKick                          //移除成员
+	PermMute                          //禁言成员
+	PermPin                           //置顶消息
+	PermRecall                        //撤回他人消息
+	PermSetAdmin                      //设置管理员
+	PermAnnounce                      //发布/编辑群公告
+)
+
+// 权限矩阵  角色 -> 拥有的权限
+var groupPerms = map[int][]GroupPerm{
+	RoleOwner:  {PermRename, PermInvite, PermKick, PermMute, PermPin, PermRecall, PermSetAdmin, PermAnnounce},
+	RoleAdmin:  {PermRename, PermInvite, PermKick, PermMute, PermPin, PermRecall, PermAnnounce},
+	RoleMember: {PermInvite},
+}
+
+// 群成员信息
+type GroupMember struct {
+	UserId   uint
+	Name     string
+	Avatar   string
+	Role     int
+	JoinTime int64
+}
+
+// 角色是否拥有某项权限
+func roleCan(role int, perm GroupPerm) bool {
+	for _, p := range groupPerms[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// 用户在群内的角色  不是群成员时 ok 为 false
+func groupRole(userId uint, communityId uint) (role int, ok bool) {
+	_, _, role, ok = groupMembership(userId, communityId)
+	return role, ok
+}
+
+// 用户在群内的成员记录、群信息和角色
+// 群主以 Community.OwnerId 为准，兼容没有记录角色的旧数据
+func groupMembership(userId uint, communityId uint) (*Contact, *Community, int, bool) {
+	contact := Contact{}
+	utils.DB.Where("owner_id = ? and target_id = ? and type=2", userId, communityId).First(&contact)
+	if contact.ID == 0 {
+		return nil, nil, RoleMember, false
+	}
+	community := Community{}
+	utils.DB.Where("id = ?", communityId).First(&community)
+	if community.OwnerId == userId {
+		return &contact, &community, RoleOwner, true
+	}
+	if contact.Role == RoleOwner {
+		// 群主已转让，旧记录按管理员处理
+		return &contact, &community, RoleAdmin, true
+	}
+	return &contact, &community, contact.Role, true
+}
+
+// 用户在群内是否拥有某项权限
+func HasGroupPerm(userId uint, communityId uint, perm GroupPerm) bool {
+	role, ok := groupRole(userId, communityId)
+	return ok && roleCan(role, perm)
+}
+
+// 操作者能否管理目标成员  需要权限且角色高于对方
+func canManage(operatorId uint, targetId uint, communityId uint, perm GroupPerm) (int, string) {
+	role, ok := groupRole(operatorId, communityId)
+	if !ok {
+		return -1, "你不是该群成员"
+	}
+	if !roleCan(role, perm) {
+		return -1, "没有操作权限"
+	}
+	targetRole, ok := groupRole(targetId, communityId)
+	if !ok {
+		return -1, "对方不是该群成员"
+	}
+	if targetRole >= role {
+		return -1, "不能操作同级或更高角色的成员"
+	}
+	return 0, ""
+}
+
+// 群成员列表  群主、管理员在前
+func GroupMembers(userId uint, communityId uint) ([]GroupMember, string) {
+	if !IsGroupMember(userId, communityId) {
+		return nil, "你不是该群成员"
+	}
+	community := Community{}
+	utils.DB.Where("id = ?", communityId).First(&community)
+	contacts := make([]Contact, 0)
+	utils.DB.Where("target_id = ? and type=2", communityId).Order("id asc").Find(&contacts)
+	ids := make([]uint, 0, len(contacts))
+	for _, v := range contacts {
+		ids = append(ids, v.OwnerId)
+	}
+	users := make([]UserBasic, 0)
+	utils.DB.Where("id in ?", ids).Find(&users)
+	userMap := make(map[uint]UserBasic, len(users))
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+
+	owners, admins, members := make([]GroupMember, 0), make([]GroupMember, 0), make([]GroupMember, 0)
+	for _, v := range contacts {
+		m := GroupMember{UserId: v.OwnerId, Role: v.Role, JoinTime: v.CreatedAt.Unix()}
+		if u, ok := userMap[v.OwnerId]; ok {
+			m.Name, m.Avatar = u.Name, u.Avatar
+		}
+		switch {
+		case v.OwnerId == community.OwnerId:
+			m.Role = RoleOwner
+			owners = append(owners, m)
+		case v.Role == RoleAdmin || v.Role == RoleOwner:
+			m.Role = RoleAdmin
+			admins = append(admins, m)
+		default:
+			m.Role = RoleMember
+			members = append(members, m)
+		}
+	}
+	return append(append(owners, admins...), members...), "查询成功"
+}
+
+// 设置/取消管理员  只有群主可以操作
+func SetGroupAdmin(operatorId uint, communityId uint, targetId uint, admin bool) (int, string) {
+	if !HasGroupPerm(operatorId, communityId, PermSetAdmin) {
+		return -1, "没有操作权限"
+	}
+	if operatorId == targetId {
+		return -1, "不能修改自己的角色"
+	}
+	if !IsGroupMember(targetId, communityId) {
+		return -1, "对方不是该群成员"
+	}
+	role := RoleMember
+	if admin {
+		role = RoleAdmin
+	}
+	err := utils.DB.Model(&Contact{}).Where("owner_id = ? and target_id = ? and type=2", targetId, communityId).
+		Update("role", role).Error
+	if err != nil {
+		return -1, "设置失败"
+	}
+	return 0, "设置成功"
+}
+
+// 修改群资料  空值表示不修改
+func UpdateCommunity(operatorId uint, communityId uint, name string, img string, desc string) (int, string) {
+	if !HasGroupPerm(operatorId, communityId, PermRename) {
+		return -1, "没有操作权限"
+	}
+	updates := make(map[string]interface{})
+	if name = strings.TrimSpace(name); name != "" {
+		updates["name"] = name
+	}
+	if img != "" {
+		updates["img"] = img
+	}
+	if desc != "" {
+		updates["desc"] = desc
+	}
+	if len(updates) == 0 {
+		return -1, "没有需要修改的内容"
+	}
+	if err := utils.DB.Model(&Community{}).Where("id = ?", communityId).Updates(updates).Error; err != nil {
+		return -1, "修改失败"
+	}
+	return 0, "修改成功"
+}
+
+// 邀请用户入群  需审核的群里普通成员的邀请进入审核队列
+func InviteToGroup(operatorId uint, communityId uint, targetId uint) (int, string) {
+	if !HasGroupPerm(operatorId, communityId, PermInvite) {
+		return -1, "没有操作权限"
+	}
+	user := FindByID(targetId)
+	if user.ID == 0 {
+		return -1, "没有找到此用户"
+	}
+	if IsGroupMember(targetId, communityId) {
+		return -1, "对方已在群内"
+	}
+	if isGroupBanned(targetId, communityId) {
+		return -1, "对方在群黑名单中"
+	}
+	community := Community{}
+	utils.DB.Where("id = ?", communityId).First(&community)
+	if community.JoinPolicy == JoinPolicyApproval && !isGroupAdmin(operatorId, communityId) {
+		return sendJoinRequest(targetId, communityId, FindByID(operatorId).Name+" 邀请 "+user.Name+" 入群")
+	}
+	if err := addGroupMember(targetId, communityId); err != nil {
+		return -1, "邀请失败"
+	}
+	return 0, "邀请成功"
+}
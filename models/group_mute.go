@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+	"simple-chatroom/utils"
+	"strconv"
+	"time"
+)
+
+// 单次禁言的最长时长
+const maxMuteDuration = 30 * 24 * time.Hour
+
+// 群成员发言校验  全员禁言时只有群主和管理员可以发言，个人禁言对管理员同样生效
+func CheckGroupMute(contact *Contact, role int, community *Community) error {
+	if contact.MuteUntil > time.Now().Unix() {
+		until := time.Unix(contact.MuteUntil, 0).Format("2006-01-02 15:04:05")
+		return &ChatError{ErrMuted.Code, ErrMuted.Msg + "，" + until + " 后解除"}
+	}
+	if community.AdminsOnly && role < RoleAdmin {
+		return ErrAdminsOnly
+	}
+	return nil
+}
+
+// 禁言群成员  minutes 为 0 表示解除禁言
+func MuteMember(operatorId uint, communityId uint, targetId uint, minutes int) (int, string) {
+	if minutes < 0 || time.Duration(minutes)*time.Minute > maxMuteDuration {
+		return -1, "禁言时长不合法"
+	}
+	if code, msg := canManage(operatorId, targetId, communityId, PermMute); code != 0 {
+		return code, msg
+	}
+	var until int64
+	if minutes > 0 {
+		until = time.Now().Add(time.Duration(minutes) * time.Minute).Unix()
+	}
+	err := utils.DB.Model(&Contact{}).Where("owner_id = ? and target_id = ? and type=2", targetId, communityId).
+		Update("mute_until", until).Error
+	if err != nil {
+		fmt.Println("禁言失败:", err)
+		return -1, "操作失败"
+	}
+	operator, target := FindByID(operatorId).Name, FindByID(targetId).Name
+	if minutes > 0 {
+		postGroupSystemMsg(communityId, operatorId, GroupEventMute, target+" 被 "+operator+" 禁言 "+strconv.Itoa(minutes)+" 分钟")
+		return 0, "禁言成功"
+	}
+	postGroupSystemMsg(communityId, operatorId, GroupEventMute, target+" 被 "+operator+" 解除禁言")
+	return 0, "已解除禁言"
+}
+
+// 开启/关闭全员禁言（仅群主和管理员可发言）
+func SetAdminsOnly(operatorId uint, communityId uint, on bool) (int, string) {
+	if !HasGroupPerm(operatorId, communityId, PermMute) {
+		return -1, "没有操作权限"
+	}
+	if err := utils.DB.Model(&Community{}).Where("id = ?", communityId).Update("admins_only", on).Error; err != nil {
+		return -1, "操作失败"
+	}
+	content := FindByID(operatorId).Name + " 关闭了全员禁言"
+	if on {
+		content = FindByID(operatorId).Name + " 开启了全员禁言"
+	}
+	postGroupSystemMsg(communityId, operatorId, GroupEventAdminsOnly, content)
+	return 0, "设置成功"
+}
+
+// 设置群消息免打扰
+func SetGroupNotifyMuted(userId uint, communityId uint, muted bool) (int, string) {
+	res := utils.DB.Model(&Contact{}).Where("owner_id = ? and target_id = ? and type=2", userId, communityId).
+		Update("notify_muted", muted)
+	if res.Error != nil {
+		return -1, "设置失败"
+	}
+	if res.RowsAffected == 0 && !IsGroupMember(userId, communityId) {
+		return -1, "你不是该群成员"
+	}
+	return 0, "设置成功"
+}
+
+// 开启了免打扰的群
+func NotifyMutedGroups(userId uint) []uint {
+	ids := make([]uint, 0)
+	utils.DB.Model(&Contact{}).Where("owner_id = ? and type=2 and notify_muted = ?", userId, true).Pluck("target_id", &ids)
+	return ids
+}
+
+// 群内开启了免打扰的成员
+func notifyMutedMembers(communityId uint) map[uint]bool {
+	ids := make([]uint, 0)
+	utils.DB.Model(&Contact{}).Where("target_id = ? and type=2 and notify_muted = ?", communityId, true).Pluck("owner_id", &ids)
+	res := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		res[id] = true
+	}
+	return res
+}
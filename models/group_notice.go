@@ -0,0 +1,354 @@
+package models
+
+import (
+	"fmt"
+	"simple-chatroom/utils"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 群公告
+type GroupAnnouncement struct {
+	gorm.Model
+	CommunityId uint `gorm:"index"`
+	AuthorId    uint //发布人
+	Title       string
+	Content     string
+	EditorId    uint //最后编辑人
+	EditTime    uint64
+	ReadCount   int64 `gorm:"-"` //已读人数
+	HasRead     bool  `gorm:"-"` //当前用户是否已读
+}
+
+func (table *GroupAnnouncement) TableName() string {
+	return "group_announcement"
+}
+
+// 群公告编辑记录  保存每次编辑前的内容
+type GroupAnnouncementEdit struct {
+	ID             uint `gorm:"primarykey"`
+	AnnouncementId uint `gorm:"index"`
+	EditorId       uint
+	Title          string //编辑前的标题
+	Content        string //编辑前的内容
+	EditTime       uint64
+}
+
+func (table *GroupAnnouncementEdit) TableName() string {
+	return "group_announcement_edit"
+}
+
+// 群公告已读记录
+type GroupAnnouncementRead struct {
+	ID             uint `gorm:"primarykey"`
+	AnnouncementId uint `gorm:"uniqueIndex:idx_announcement_read"`
+	UserId         uint `gorm:"uniqueIndex:idx_announcement_read"`
+	ReadTime       uint64
+}
+
+func (table *GroupAnnouncementRead) TableName() string {
+	return "group_announcement_read"
+}
+
+// 群置顶消息
+type GroupPin struct {
+	ID          uint `gorm:"primarykey"`
+	CommunityId uint `gorm:"uniqueIndex:idx_group_pin"`
+	MsgId       uint `gorm:"uniqueIndex:idx_group_pin"`
+	OperatorId  uint
+	PinTime     uint64
+}
+
+func (table *GroupPin) TableName() string {
+	return "group_pin"
+}
+
+// 群资料变更事件  放在 Desc 中
+const (
+	GroupEventAnnounce       = "announce"
+	GroupEventAnnounceEdit   = "announceEdit"
+	GroupEventAnnounceDelete = "announceDelete"
+	GroupEventPin            = "pin"
+	GroupEventUnpin          = "unpin"
+)
+
+// 每个群最多置顶的消息数
+func maxGroupPins() int64 {
+	n := viper.GetInt64("group.maxPins")
+	if n <= 0 {
+		n = 10
+	}
+	return n
+}
+
+// 推送群资料变更事件  MsgId 为公告或被置顶的消息
+func notifyGroupEvent(communityId uint, operatorId uint, event string, id uint, content string) {
+	msg := Message{
+		UserId:     int64(operatorId),
+		TargetId:   int64(communityId),
+		Type:       MsgTypeGroupEvent,
+		Desc:       event,
+		MsgId:      id,
+		Content:    content,
+		CreateTime: uint64(time.Now().Unix()),
+	}
+	data, _ := msg.MarshalBinary()
+	for _, uid := range SearchUserByGroupId(communityId) {
+		sendMsgToUser(int64(uid), data)
+	}
+}
+
+// 发布群公告
+func PublishAnnouncement(operatorId uint, communityId uint, title string, content string) (*GroupAnnouncement, string) {
+	if !HasGroupPerm(operatorId, communityId, PermAnnounce) {
+		return nil, "没有操作权限"
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, "公告内容不能为空"
+	}
+	ann := GroupAnnouncement{CommunityId: communityId, AuthorId: operatorId, Title: strings.TrimSpace(title), Content: content}
+	if err := utils.DB.Create(&ann).Error; err != nil {
+		fmt.Println("发布群公告失败:", err)
+		return nil, "发布失败"
+	}
+	notifyGroupEvent(communityId, operatorId, GroupEventAnnounce, ann.ID, ann.Title)
+	return &ann, "发布成功"
+}
+
+// 查找群公告
+func findAnnouncement(announcementId uint) *GroupAnnouncement {
+	ann := GroupAnnouncement{}
+	utils.DB.Where("id = ?", announcementId).First(&ann)
+	if ann.ID == 0 {
+		return nil
+	}
+	return &ann
+}
+
+// 编辑群公告  保留编辑前的内容，已读状态重新计算
+func EditAnnouncement(operatorId uint, announcementId uint, title string, content string) (*GroupAnnouncement, string) {
+	ann := findAnnouncement(announcementId)
+	if ann == nil {
+		return nil, "公告不存在"
+	}
+	if !HasGroupPerm(operatorId, ann.CommunityId, PermAnnounce) {
+		return nil, "没有操作权限"
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, "公告内容不能为空"
+	}
+	now := uint64(time.Now().Unix())
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		edit := GroupAnnouncementEdit{AnnouncementId: ann.ID, EditorId: operatorId, Title: ann.Title, Content: ann.Content, EditTime: now}
+		if err := tx.Create(&edit).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("announcement_id = ?", ann.ID).Delete(&GroupAnnouncementRead{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(ann).Updates(map[string]interface{}{
+			"title": strings.TrimSpace(title), "content": content, "editor_id": operatorId, "edit_time": now,
+		}).Error
+	})
+	if err != nil {
+		fmt.Println("编辑群公告失败:", err)
+		return nil, "编辑失败"
+	}
+	notifyGroupEvent(ann.CommunityId, operatorId, GroupEventAnnounceEdit, ann.ID, ann.Title)
+	return ann, "编辑成功"
+}
+
+// 删除群公告
+func DeleteAnnouncement(operatorId uint, announcementId uint) (int, string) {
+	ann := findAnnouncement(announcementId)
+	if ann == nil {
+		return -1, "公告不存在"
+	}
+	if !HasGroupPerm(operatorId, ann.CommunityId, PermAnnounce) {
+		return -1, "没有操作权限"
+	}
+	if err := utils.DB.Delete(ann).Error; err != nil {
+		return -1, "删除失败"
+	}
+	notifyGroupEvent(ann.CommunityId, operatorId, GroupEventAnnounceDelete, ann.ID, "")
+	return 0, "删除成功"
+}
+
+// 公告编辑历史  新的在前
+func AnnouncementEditHistory(userId uint, announcementId uint) ([]GroupAnnouncementEdit, string) {
+	ann := findAnnouncement(announcementId)
+	if ann == nil {
+		return nil, "公告不存在"
+	}
+	if !IsGroupMember(userId, ann.CommunityId) {
+		return nil, "你不是该群成员"
+	}
+	edits := make([]GroupAnnouncementEdit, 0)
+	utils.DB.Where("announcement_id = ?", announcementId).Order("id desc").Find(&edits)
+	return edits, "查询成功"
+}
+
+// 标记公告已读
+func ReadAnnouncement(userId uint, announcementId uint) (int, string) {
+	ann := findAnnouncement(announcementId)
+	if ann == nil {
+		return -1, "公告不存在"
+	}
+	if !IsGroupMember(userId, ann.CommunityId) {
+		return -1, "你不是该群成员"
+	}
+	err := utils.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&GroupAnnouncementRead{AnnouncementId: announcementId, UserId: userId, ReadTime: uint64(time.Now().Unix())}).Error
+	if err != nil {
+		return -1, "操作失败"
+	}
+	return 0, "已读"
+}
+
+// 公告的已读成员  仅群主和管理员可查看
+func AnnouncementReaders(operatorId uint, announcementId uint) ([]GroupAnnouncementRead, string) {
+	ann := findAnnouncement(announcementId)
+	if ann == nil {
+		return nil, "公告不存在"
+	}
+	if !HasGroupPerm(operatorId, ann.CommunityId, PermAnnounce) {
+		return nil, "没有操作权限"
+	}
+	reads := make([]GroupAnnouncementRead, 0)
+	utils.DB.Where("announcement_id = ?", announcementId).Order("id asc").Find(&reads)
+	return reads, "查询成功"
+}
+
+// 群公告列表  新的在前，附带已读人数和当前用户是否已读
+func groupAnnouncements(userId uint, communityId uint) []GroupAnnouncement {
+	anns := make([]GroupAnnouncement, 0)
+	utils.DB.Where("community_id = ?", communityId).Order("id desc").Find(&anns)
+	if len(anns) == 0 {
+		return anns
+	}
+	ids := make([]uint, 0, len(anns))
+	for _, a := range anns {
+		ids = append(ids, a.ID)
+	}
+	type readCount struct {
+		AnnouncementId uint
+		Count          int64
+	}
+	counts := make([]readCount, 0)
+	utils.DB.Model(&GroupAnnouncementRead{}).Select("announcement_id, count(*) as count").
+		Where("announcement_id in ?", ids).Group("announcement_id").Scan(&counts)
+	countMap := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		countMap[c.AnnouncementId] = c.Count
+	}
+	readIds := make([]uint, 0)
+	utils.DB.Model(&GroupAnnouncementRead{}).Where("announcement_id in ? and user_id = ?", ids, userId).Pluck("announcement_id", &readIds)
+	readSet := make(map[uint]bool, len(readIds))
+	for _, id := range readIds {
+		readSet[id] = true
+	}
+	for i := range anns {
+		anns[i].ReadCount = countMap[anns[i].ID]
+		anns[i].HasRead = readSet[anns[i].ID]
+	}
+	return anns
+}
+
+// 置顶群消息  超出上限时拒绝
+func PinMessage(operatorId uint, msgId uint) (int, string) {
+	msg, err := findChatMessage(msgId)
+	if err != nil || msg.Type != MsgTypeGroup {
+		return -1, "消息不存在"
+	}
+	if msg.Recalled {
+		return -1, "消息已撤回"
+	}
+	communityId := uint(msg.TargetId)
+	if !HasGroupPerm(operatorId, communityId, PermPin) {
+		return -1, "没有操作权限"
+	}
+	var count int64
+	utils.DB.Model(&GroupPin{}).Where("community_id = ?", communityId).Count(&count)
+	if count >= maxGroupPins() {
+		return -1, fmt.Sprintf("最多置顶 %d 条消息", maxGroupPins())
+	}
+	res := utils.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&GroupPin{CommunityId: communityId, MsgId: msgId, OperatorId: operatorId, PinTime: uint64(time.Now().Unix())})
+	if res.Error != nil {
+		return -1, "置顶失败"
+	}
+	if res.RowsAffected == 0 {
+		return -1, "消息已置顶"
+	}
+	notifyGroupEvent(communityId, operatorId, GroupEventPin, msgId, msg.Content)
+	return 0, "置顶成功"
+}
+
+// 取消置顶
+func UnpinMessage(operatorId uint, communityId uint, msgId uint) (int, string) {
+	if !HasGroupPerm(operatorId, communityId, PermPin) {
+		return -1, "没有操作权限"
+	}
+	res := utils.DB.Where("community_id = ? and msg_id = ?", communityId, msgId).Delete(&GroupPin{})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return -1, "消息未置顶"
+	}
+	notifyGroupEvent(communityId, operatorId, GroupEventUnpin, msgId, "")
+	return 0, "已取消置顶"
+}
+
+// 群置顶消息  最近置顶的在前，已撤回的消息不返回
+func groupPins(communityId uint) []Message {
+	pins := make([]GroupPin, 0)
+	utils.DB.Where("community_id = ?", communityId).Order("pin_time desc, id desc").Find(&pins)
+	ids := make([]uint, 0, len(pins))
+	for _, p := range pins {
+		ids = append(ids, p.MsgId)
+	}
+	msgs := make([]Message, 0)
+	utils.DB.Where("id in ? and recalled = ?", ids, false).Find(&msgs)
+	msgMap := make(map[uint]Message, len(msgs))
+	for _, m := range msgs {
+		msgMap[m.ID] = m
+	}
+	res := make([]Message, 0, len(msgs))
+	for _, id := range ids {
+		if m, ok := msgMap[id]; ok {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// 群详情
+type GroupDetail struct {
+	Community     Community
+	Role          int   //当前用户的角色
+	MemberCount   int64 //成员数
+	NotifyMuted   bool  //当前用户是否开启免打扰
+	MuteUntil     int64 //当前用户的禁言截止时间
+	Announcements []GroupAnnouncement
+	Pins          []Message
+}
+
+// 查询群详情  包括资料、公告和置顶消息
+func GetGroupDetail(userId uint, communityId uint) (*GroupDetail, string) {
+	contact, community, role, ok := groupMembership(userId, communityId)
+	if !ok {
+		return nil, "你不是该群成员"
+	}
+	detail := GroupDetail{
+		Community:   *community,
+		Role:        role,
+		NotifyMuted: contact.NotifyMuted,
+		MuteUntil:   contact.MuteUntil,
+	}
+	utils.DB.Model(&Contact{}).Where("target_id = ? and type=2", communityId).Count(&detail.MemberCount)
+	detail.Announcements = groupAnnouncements(userId, communityId)
+	detail.Pins = groupPins(communityId)
+	return &detail, "查询成功"
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"simple-chatroom/utils"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+)
+
+// 离线收件箱key
+func inboxKey(userId int64) string {
+	return "inbox_" + strconv.FormatInt(userId, 10)
+}
+
+// 离线收件箱最多保留的消息条数
+func inboxSize() int64 {
+	n := viper.GetInt64("inbox.size")
+	if n <= 0 {
+		n = 500
+	}
+	return n
+}
+
+// 离线消息保留时长  单位H
+func inboxTTL() time.Duration {
+	h := viper.GetInt("timeout.InboxTime")
+	if h <= 0 {
+		h = 72
+	}
+	return time.Duration(h) * time.Hour
+}
+
+// 存入离线收件箱，超出上限时丢弃最早的消息
+func saveToInbox(userId int64, msg []byte) {
+	ctx := context.Background()
+	key := inboxKey(userId)
+	if err := utils.Red.RPush(ctx, key, msg).Err(); err != nil {
+		fmt.Println("离线消息保存失败:", err)
+		return
+	}
+	utils.Red.LTrim(ctx, key, -inboxSize(), -1)
+	utils.Red.Expire(ctx, key, inboxTTL())
+}
+
+// 用户重新连接后按顺序投递离线消息
+// 逐条弹出并放入发送队列，队列持续占满或连接已关闭时放回收件箱
+// 补发结束后再放行补发期间暂存的实时消息
+func flushInbox(userId int64, node *Node) {
+	defer node.finishFlush()
+	ctx := context.Background()
+	key := inboxKey(userId)
+	for {
+		data, err := utils.Red.LPop(ctx, key).Bytes()
+		if err == redis.Nil {
+			return
+		}
+		if err != nil {
+			fmt.Println("读取离线消息失败:", err)
+			return
+		}
+		if !enqueueWait(node, data, 5*time.Second) {
+			utils.Red.LPush(ctx, key, data)
+			return
+		}
+	}
+}
+
+// 队列满时等待发送协程消费，超时返回 false
+func enqueueWait(node *Node, data []byte, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !node.enqueueFlush(data) {
+		if node.isClosed() || time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"simple-chatroom/utils"
+	"time"
+	"unicode/utf8"
+)
+
+// @提醒记录  @所有人时为每个成员各记一条，便于查询“提到我的”
+type MessageMention struct {
+	ID         uint  `gorm:"primarykey"`
+	MsgId      uint  `gorm:"index"`
+	UserId     int64 `gorm:"index:idx_mention_user"`
+	GroupId    int64
+	CreateTime uint64
+}
+
+func (table *MessageMention) TableName() string {
+	return "message_mention"
+}
+
+// @所有人
+const MentionAllName = "all"
+
+// 用户名遇到空白（含全角空格）或标点（含中文标点）结束，保留下划线和连字符
+var mentionPattern = regexp.MustCompile(`@((?:[_-]|[^\p{Z}\s\p{P}@])+)`)
+
+// 解析内容中的 @用户名，返回去重后的用户名以及是否 @所有人
+func ParseMentions(content string) ([]string, bool) {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	all := false
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := m[1]
+		if name == MentionAllName {
+			all = true
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, all
+}
+
+// 把 @用户名 解析成群成员ID，写入消息
+func resolveMentions(msg *Message, memberIds []uint) {
+	names, all := ParseMentions(msg.Content)
+	msg.MentionAll = all
+	if len(names) == 0 {
+		return
+	}
+	users := make([]UserBasic, 0)
+	utils.DB.Where("name in ? and id in ?", names, memberIds).Find(&users)
+	for _, u := range users {
+		if int64(u.ID) != msg.UserId {
+			msg.MentionIds = append(msg.MentionIds, int64(u.ID))
+		}
+	}
+}
+
+// 记录@提醒，并给被提到的成员单独推送提醒（不受群消息免打扰影响，离线时进收件箱）
+func notifyMentions(msg *Message) {
+	targets := msg.MentionIds
+	if msg.MentionAll {
+		targets = make([]int64, 0)
+		for _, id := range SearchUserByGroupId(uint(msg.TargetId)) {
+			if int64(id) != msg.UserId {
+				targets = append(targets, int64(id))
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	now := uint64(time.Now().Unix())
+	rows := make([]MessageMention, 0, len(targets))
+	for _, id := range targets {
+		rows = append(rows, MessageMention{MsgId: msg.ID, UserId: id, GroupId: msg.TargetId, CreateTime: now})
+	}
+	if err := utils.DB.CreateInBatches(rows, 200).Error; err != nil {
+		fmt.Println("@提醒保存失败:", err)
+	}
+
+	event := Message{
+		UserId:     msg.UserId,
+		TargetId:   msg.TargetId,
+		Type:       MsgTypeMention,
+		Media:      MsgTypeGroup, //Media 为会话类型
+		Content:    mentionSnippet(msg.Content),
+		MsgId:      msg.ID,
+		Seq:        msg.Seq,
+		MentionAll: msg.MentionAll,
+		CreateTime: now,
+	}
+	data, _ := event.MarshalBinary()
+	for _, id := range targets {
+		sendMsgToUser(id, data)
+	}
+}
+
+// 提醒里展示的内容摘要
+func mentionSnippet(content string) string {
+	if utf8.RuneCountInString(content) <= 50 {
+		return content
+	}
+	return string([]rune(content)[:50]) + "..."
+}
+
+// 提到我的消息，按消息ID倒序分页  cursor 为上一页最后一条消息的ID
+func MentionsOfMe(userId int64, cursor int64, limit int) ([]Message, int64, bool) {
+	msgIds := make([]uint, 0)
+	tx := utils.DB.Model(&MessageMention{}).Where("user_id = ?", userId)
+	if cursor > 0 {
+		tx = tx.Where("msg_id < ?", cursor)
+	}
+	tx.Order("msg_id desc").Limit(limit+1).Pluck("msg_id", &msgIds)
+
+	hasMore := len(msgIds) > limit
+	if hasMore {
+		msgIds = msgIds[:limit]
+	}
+	msgs := make([]Message, 0)
+	if len(msgIds) > 0 {
+		utils.DB.Where("id in ?", msgIds).Order("id desc").Find(&msgs)
+	}
+	if n := len(msgIds); n > 0 {
+		cursor = int64(msgIds[n-1])
+	}
+	attachReactions(msgs)
+	return msgs, cursor, hasMore
+}
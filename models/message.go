@@ -4,14 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/http"
-	"simple-chatroom/utils"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
 	"github.com/spf13/viper"
 	"gopkg.in/fatih/set.v0"
@@ -21,39 +19,79 @@ import (
 // 消息
 type Message struct {
 	gorm.Model
-	UserId     int64  `json:"UserId"`     //发送者
-	TargetId   int64  `json:"TargetId"`   //接受者
-	Type       int    `json:"Type"`       //发送类型  1私聊  2群聊  3心跳
-	Media      int    `json:"Media"`      //消息类型  1文字 2表情包 3语音 4图片 /表情包
-	Content    string `json:"Content"`    //消息内容
-	CreateTime uint64 `json:"CreateTime"` //创建时间
-	ReadTime   uint64 `json:"ReadTime"`   //读取时间
-	Pic        string `json:"Pic"`
-	Url        string `json:"Url"`
-	Desc       string `json:"Desc"`
-	Amount     int    `json:"Amount"` //其他数字统计
+	UserId     int64             `json:"UserId"`     //发送者
+	TargetId   int64             `json:"TargetId"`   //接受者
+	Type       int               `json:"Type"`       //发送类型  1私聊  2群聊  3心跳  4送达回执  5已读回执
+	Media      int               `json:"Media"`      //消息类型  1文字 2表情包 3语音 4图片 /表情包
+	Content    string            `json:"Content"`    //消息内容
+	CreateTime uint64            `json:"CreateTime"` //创建时间
+	ReadTime   uint64            `json:"ReadTime"`   //读取时间
+	Pic        string            `json:"Pic"`
+	Url        string            `json:"Url"`
+	Desc       string            `json:"Desc"`
+	Amount     int               `json:"Amount"`                                      //其他数字统计
+	Seq        int64             `json:"Seq"`                                         //会话内序号  由服务端分配，严格递增
+	MsgId      uint              `json:"MsgId" gorm:"-"`                              //回执等事件所指向的消息ID，不落库
+	EditTime   uint64            `json:"EditTime"`                                    //最后编辑时间
+	Recalled   bool              `json:"Recalled"`                                    //是否已撤回
+	ReplyTo    uint              `json:"ReplyTo"`                                     //引用回复的消息ID
+	ThreadId   uint              `json:"ThreadId"`                                    //所属话题的根消息ID
+	ReplyCount int               `json:"ReplyCount"`                                  //话题回复数  仅根消息
+	Reactions  []ReactionSummary `json:"Reactions,omitempty" gorm:"-"`                //表情回应汇总，读取历史时填充
+	MentionIds []int64           `json:"MentionIds,omitempty" gorm:"serializer:json"` //被@的用户ID
+	MentionAll bool              `json:"MentionAll"`                                  //是否@所有人
 }
 
 func (table *Message) TableName() string {
 	return "message"
 }
 
+// 消息发送类型
+const (
+	MsgTypePrivate       = 1  //私聊
+	MsgTypeGroup         = 2  //群聊
+	MsgTypeHeartbeat     = 3  //心跳
+	MsgTypeDelivered     = 4  //送达回执
+	MsgTypeRead          = 5  //已读回执
+	MsgTypePresence      = 6  //在线状态  Content 为 online / away / offline
+	MsgTypeTyping        = 7  //正在输入  Content 为 start / stop，Media 为会话类型，不落库
+	MsgTypeEdit          = 8  //编辑消息  MsgId 为被编辑的消息，Amount 为操作者，Desc 为会话类型
+	MsgTypeError         = 9  //错误通知  服务端返回给发送者
+	MsgTypeRecall        = 10 //撤回消息  MsgId 为被撤回的消息，Amount 为操作者，Desc 为会话类型
+	MsgTypeReaction      = 11 //表情回应  MsgId 为目标消息，Content 为表情，Desc 为 add / remove
+	MsgTypeMention       = 12 //@提醒  MsgId 为提到你的群消息
+	MsgTypeFriendRequest = 13 //好友申请  MsgId 为申请ID，Amount 为申请状态
+	MsgTypeGroupJoin     = 14 //入群申请  MsgId 为申请ID，TargetId 为群，Amount 为申请状态
+	MsgTypeGroupEvent    = 15 //群公告/置顶变更  Desc 为事件，MsgId 为公告或消息ID
+)
+
+// 群系统消息  Type 为群聊，Desc 为事件（leave / kick / transfer / disband / mute / adminsOnly）
+const MediaSystem = 5
+
 // const (
 // 	HeartbeatMaxTime = 1 * 60
 // )
 
 type Node struct {
+	UserId        int64           //所属用户
+	DeviceId      string          //设备/会话ID
+	DeviceInfo    string          //设备信息（User-Agent）
 	Conn          *websocket.Conn //连接
 	Addr          string          //客户端地址
 	FirstTime     uint64          //首次连接时间
-	HeartbeatTime uint64          //心跳时间
+	HeartbeatTime atomic.Uint64   //心跳时间
 	LoginTime     uint64          //登录时间
 	DataQueue     chan []byte     //消息
 	GroupSets     set.Interface   //好友 / 群
+	Envelope      atomic.Bool     //是否使用信封协议收发
+	mu            sync.RWMutex    //保护 closed / flushing / pending，关闭后不再写入 DataQueue
+	closed        bool
+	flushing      bool     //正在补发离线消息
+	pending       [][]byte //补发期间暂存的实时消息
 }
 
-// 映射关系
-var clientMap map[int64]*Node = make(map[int64]*Node, 0)
+// 映射关系  用户ID -> 设备ID -> 连接
+var clientMap map[int64]map[string]*Node = make(map[int64]map[string]*Node, 0)
 
 // 读写锁
 var rwLocker sync.RWMutex
@@ -101,264 +139,286 @@ func Chat(writer http.ResponseWriter, request *http.Request) {
 	}
 	//2.获取conn
 	currentTime := uint64(time.Now().Unix())
-	node := &Node{
-		Conn:          conn,
-		Addr:          conn.RemoteAddr().String(), //客户端地址
-		HeartbeatTime: currentTime,                //心跳时间
-		LoginTime:     currentTime,                //登录时间
-		DataQueue:     make(chan []byte, 50),
-		GroupSets:     set.New(set.ThreadSafe),
+	deviceId := query.Get("deviceId")
+	if deviceId == "" {
+		deviceId = conn.RemoteAddr().String()
 	}
+	node := &Node{
+		UserId:     userId,
+		DeviceId:   deviceId,
+		DeviceInfo: request.UserAgent(),
+		Conn:       conn,
+		Addr:       conn.RemoteAddr().String(), //客户端地址
+		LoginTime:  currentTime,                //登录时间
+		DataQueue:  make(chan []byte, 50),
+		GroupSets:  set.New(set.ThreadSafe),
+		flushing:   true, //离线消息补发完成前实时消息先暂存，保证顺序
+	}
+	node.HeartbeatTime.Store(currentTime)
+	node.Envelope.Store(query.Get("v") == strconv.Itoa(ProtocolVersion))
 	//3. 用户关系
 	//4. userid 跟 node绑定 并加锁
-	rwLocker.Lock()
-	clientMap[userId] = node
-	rwLocker.Unlock()
+	registerNode(node)
 	//5.完成发送逻辑
 	go sendProc(node)
+	//投递离线期间的消息，完成后再放行暂存的实时消息
+	go flushInbox(userId, node)
 	//6.完成接受逻辑
 	go recvProc(node)
 	//7.加入在线用户到缓存
 	SetUserOnlineInfo("online_"+Id, []byte(node.Addr), time.Duration(viper.GetInt("timeout.RedisOnlineTime"))*time.Hour)
+	userOnline(userId)
 
 	//sendMsg(userId, []byte("欢迎进入聊天系统"))
 
 }
 
+// 发送协程：写出队列中的消息，并定时发送 ping 探活
 func sendProc(node *Node) {
+	ticker := time.NewTicker(pingPeriod())
+	defer func() {
+		ticker.Stop()
+		node.Close()
+	}()
 	for {
 		select {
-		case data := <-node.DataQueue:
+		case data, ok := <-node.DataQueue:
+			if !ok {
+				node.Conn.WriteControl(websocket.CloseMessage, []byte{}, time.Now().Add(writeWait))
+				return
+			}
+			if node.Envelope.Load() {
+				data = WrapPush(data)
+			}
 			fmt.Println("[ws]sendProc >>>> msg :", string(data))
+			node.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			err := node.Conn.WriteMessage(websocket.TextMessage, data)
 			if err != nil {
 				fmt.Println(err)
 				return
 			}
+		case <-ticker.C:
+			if err := node.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				fmt.Println("ping 失败:", err)
+				return
+			}
 		}
 	}
 }
 
+// 接收协程：读超时内收不到任何数据（含 pong）即视为断线
 func recvProc(node *Node) {
+	defer node.Close()
+	node.Conn.SetReadDeadline(time.Now().Add(pongWait()))
+	node.Conn.SetPongHandler(func(string) error {
+		node.Heartbeat(uint64(time.Now().Unix()))
+		return nil
+	})
 	for {
 		_, data, err := node.Conn.ReadMessage()
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
-		msg := Message{}
-		err = json.Unmarshal(data, &msg)
+		env, msg, err := ParseFrame(data)
+		if env != nil {
+			node.Envelope.Store(true)
+		}
+		corrId := ""
+		if env != nil {
+			corrId = env.Id
+		}
 		if err != nil {
 			fmt.Println(err)
+			node.reply(corrId, nil, ErrBadFrame)
+			continue
 		}
 		//心跳检测 msg.Media == -1 || msg.Type == 3
-		if msg.Type == 3 {
+		if msg.Type == MsgTypeHeartbeat {
 			currentTime := uint64(time.Now().Unix())
 			node.Heartbeat(currentTime)
+			if env != nil {
+				node.reply(corrId, &msg, nil)
+			}
 		} else {
-			dispatch(data)
-			broadMsg(data) //todo 将消息广播到局域网
+			res, err := dispatch(node, msg)
+			e, _ := err.(*ChatError)
+			node.reply(corrId, res, e)
 			fmt.Println("[ws] recvProc <<<<< ", string(data))
 		}
 
 	}
 }
 
-var udpsendChan chan []byte = make(chan []byte, 1024)
-
-func broadMsg(data []byte) {
-	udpsendChan <- data
-}
-
-func init() {
-	go udpSendProc()
-	go udpRecvProc()
-	fmt.Println("init goroutine ")
-}
-
-// 完成udp数据发送协程
-func udpSendProc() {
-	con, err := net.DialUDP("udp", nil, &net.UDPAddr{
-		IP:   net.IPv4(192, 168, 0, 255),
-		Port: viper.GetInt("port.udp"),
-	})
-
-	if err != nil {
-		fmt.Println(err)
-	}
-	if con == nil {
-		fmt.Println("con is nil")
-		return
-	}
-	defer con.Close()
-	for {
-		select {
-		case data := <-udpsendChan:
-			fmt.Println("udpSendProc  data :", string(data))
-			_, err := con.Write(data)
-			if err != nil {
-				fmt.Println(err)
-				return
-			}
+// 后端调度逻辑处理，返回服务端处理后的消息（已分配ID和序号）
+// 发送者以连接建立时绑定的身份为准，忽略客户端上报的 UserId
+func dispatch(node *Node, msg Message) (*Message, error) {
+	msg.UserId = node.UserId
+	var err error
+	switch msg.Type {
+	case MsgTypePrivate: //私信
+		err = sendMsg(&msg, node.DeviceId)
+	case MsgTypeGroup: //群发
+		err = sendGroupMsg(&msg)
+	case MsgTypeDelivered, MsgTypeRead: //送达/已读回执
+		err = handleReceipt(msg)
+	case MsgTypePresence: //客户端切换 在线/离开
+		err = changePresence(node.UserId, msg.Content)
+	case MsgTypeTyping: //正在输入
+		err = sendTyping(&msg)
+	case MsgTypeEdit: //编辑
+		var res *Message
+		res, err = EditMessage(node.UserId, msg.MsgId, msg.Content)
+		if err == nil {
+			return res, nil
 		}
-	}
-
-}
-
-// 完成udp数据接收协程
-func udpRecvProc() {
-	con, err := net.ListenUDP("udp", &net.UDPAddr{
-		IP:   net.IPv4zero,
-		Port: viper.GetInt("port.udp"),
-	})
-	if err != nil {
-		fmt.Println(err)
-	}
-	defer con.Close()
-	for {
-		var buf [512]byte
-		n, err := con.Read(buf[0:])
-		if err != nil {
-			fmt.Println(err)
-			return
+	case MsgTypeReaction: //表情回应
+		err = ReactMessage(node.UserId, msg.MsgId, msg.Content, msg.Desc != ReactionRemove)
+	case MsgTypeRecall: //撤回
+		var res *Message
+		res, err = RecallMessage(node.UserId, msg.MsgId)
+		if err == nil {
+			return res, nil
 		}
-		fmt.Println("udpRecvProc  data :", string(buf[0:n]))
-		dispatch(buf[0:n])
+	default:
+		err = ErrUnknownType
 	}
-}
-
-// 后端调度逻辑处理
-func dispatch(data []byte) {
-	msg := Message{}
-	msg.CreateTime = uint64(time.Now().Unix())
-	err := json.Unmarshal(data, &msg)
 	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	switch msg.Type {
-	case 1: //私信
-		fmt.Println("dispatch  data :", string(data))
-		sendMsg(msg.TargetId, data)
-	case 2: //群发
-		sendGroupMsg(msg.TargetId, data)
-		// case 4: // 心跳
-		// node.Heartbeat()
-		//case 4:
-		//
+		return nil, err
 	}
+	return &msg, nil
 }
 
-func sendGroupMsg(targetId int64, msg []byte) {
+func sendGroupMsg(jsonMsg *Message) error {
 	fmt.Println("开始群发消息")
-	userIds := SearchUserByGroupId(uint(targetId))
-	jsonMsg := Message{}
-	json.Unmarshal(msg, &jsonMsg)
+	if err := checkGroupSend(jsonMsg.UserId, jsonMsg.TargetId); err != nil {
+		return err
+	}
+	if err := prepareMessage(jsonMsg); err != nil {
+		return err
+	}
+	userIds := SearchUserByGroupId(uint(jsonMsg.TargetId))
+	resolveMentions(jsonMsg, userIds)
 
-	// 保存群聊消息到Redis
+	// 分配会话序号，群聊消息落库，并写入Redis热缓存
 	ctx := context.Background()
-	groupKey := "group_msg_" + strconv.Itoa(int(targetId))
-	res, err := utils.Red.ZRevRange(ctx, groupKey, 0, -1).Result()
-	if err != nil {
-		fmt.Println("Redis ZRevRange error:", err)
-	}
-	score := float64(cap(res)) + 1
-	ress, e := utils.Red.ZAdd(ctx, groupKey, &redis.Z{Score: score, Member: msg}).Result()
-	if e != nil {
-		fmt.Println("Redis ZAdd error:", e)
-	} else {
-		fmt.Println("群聊消息已保存到Redis:", ress)
-		// 设置4小时过期时间
-		utils.Red.Expire(ctx, groupKey, 4*time.Hour)
+	if err := storeMessage(ctx, groupMsgKey(jsonMsg.TargetId), groupMsgQuery(jsonMsg.TargetId), jsonMsg); err != nil {
+		return ErrStoreFailed
 	}
+	bumpReplyCount(jsonMsg)
+	msg, _ := jsonMsg.MarshalBinary()
 
 	// 发送给所有群成员（包括发送者，用于确认消息发送成功）
+	// 开启免打扰的成员只推送在线设备，不进离线收件箱，上线后通过历史消息同步
+	muted := notifyMutedMembers(uint(jsonMsg.TargetId))
 	for i := 0; i < len(userIds); i++ {
+		if muted[userIds[i]] && userIds[i] != uint(jsonMsg.UserId) {
+			pushToUser(int64(userIds[i]), msg)
+			continue
+		}
 		sendMsgToUser(int64(userIds[i]), msg)
 	}
+	notifyMentions(jsonMsg)
+	return nil
 }
 
-// 新增：单独发送消息给用户的函数
-func sendMsgToUser(userId int64, msg []byte) {
-	rwLocker.RLock()
-	node, ok := clientMap[userId]
-	rwLocker.RUnlock()
+// 推送给用户本实例上的所有在线设备，返回是否至少有一台设备已放入发送队列
+func pushToLocal(userId int64, msg []byte) bool {
+	return pushToLocalExcept(userId, "", msg)
+}
 
-	if ok {
-		fmt.Println("sendMsgToUser >>> userID: ", userId, "  msg:", string(msg))
-		select {
-		case node.DataQueue <- msg:
+// 推送给用户本实例上除 exceptDevice 以外的在线设备
+func pushToLocalExcept(userId int64, exceptDevice string, msg []byte) bool {
+	nodes := userNodes(userId)
+	if len(nodes) == 0 {
+		return false
+	}
+	fmt.Println("sendMsgToUser >>> userID: ", userId, "  msg:", string(msg))
+	delivered := false
+	for _, node := range nodes {
+		if exceptDevice != "" && node.DeviceId == exceptDevice {
+			continue
+		}
+		if node.enqueue(msg) {
 			// 消息发送成功
-		default:
-			fmt.Println("用户消息队列已满，消息丢弃")
+			delivered = true
+		} else {
+			fmt.Println("用户消息队列已满: ", userId, node.DeviceId)
 		}
-	} else {
-		fmt.Println("用户不在线: ", userId)
 	}
+	return delivered
 }
 
-func JoinGroup(userId uint, comId string) (int, string) {
-	contact := Contact{}
-	contact.OwnerId = userId
-	//contact.TargetId = comId
-	contact.Type = 2
-	community := Community{}
+// 推送给用户的在线设备（含其他实例上的连接），不在线则丢弃  用于回执等即时事件
+func pushToUser(userId int64, msg []byte) bool {
+	return deliver(userId, msg, false)
+}
 
-	utils.DB.Where("id=? or name=?", comId, comId).Find(&community)
-	if community.Name == "" {
-		return -1, "没有找到群"
-	}
-	utils.DB.Where("owner_id=? and target_id=? and type =2 ", userId, comId).Find(&contact)
-	if !contact.CreatedAt.IsZero() {
-		return -1, "已加过此群"
-	} else {
-		contact.TargetId = community.ID
-		utils.DB.Create(&contact)
-		return 0, "加群成功"
-	}
+// 单独发送消息给用户，用户不在线或队列已满时存入离线收件箱
+func sendMsgToUser(userId int64, msg []byte) {
+	deliver(userId, msg, true)
 }
 
-func sendMsg(userId int64, msg []byte) {
+// 同步给发送者的其他在线设备（含其他实例上的连接），发送消息的设备除外
+func syncToOtherDevices(userId int64, fromDevice string, msg []byte) {
+	pushToLocalExcept(userId, fromDevice, msg)
+	publishRemote(clusterEnvelope{UserId: userId, Data: msg, Except: fromDevice})
+}
 
-	rwLocker.RLock()
-	node, ok := clientMap[userId]
-	rwLocker.RUnlock()
-	jsonMsg := Message{}
-	json.Unmarshal(msg, &jsonMsg)
-	ctx := context.Background()
-	targetIdStr := strconv.Itoa(int(userId))
-	userIdStr := strconv.Itoa(int(jsonMsg.UserId))
-	jsonMsg.CreateTime = uint64(time.Now().Unix())
-	r, err := utils.Red.Get(ctx, "online_"+userIdStr).Result()
-	if err != nil {
-		fmt.Println(err)
+// 本实例直接投递，其余实例通过集群总线转发  keep 为 true 时投递失败存入离线收件箱
+func deliver(userId int64, msg []byte, keep bool) bool {
+	delivered := pushToLocal(userId, msg)
+	if routeToRemote(userId, msg, keep) {
+		delivered = true
 	}
-	if r != "" {
-		if ok {
-			fmt.Println("sendMsg >>> userID: ", userId, "  msg:", string(msg))
-			node.DataQueue <- msg
+	if !delivered {
+		fmt.Println("用户不在线: ", userId)
+		if keep {
+			saveToInbox(userId, msg)
 		}
 	}
-	var key string
-	if userId > jsonMsg.UserId {
-		key = "msg_" + userIdStr + "_" + targetIdStr
-	} else {
-		key = "msg_" + targetIdStr + "_" + userIdStr
+	return delivered
+}
+
+// 发送私聊消息  fromDevice 为发送消息的设备，消息会同步给发送者的其他设备
+func sendMsg(jsonMsg *Message, fromDevice string) error {
+	if err := checkPrivateSend(jsonMsg.UserId, jsonMsg.TargetId); err != nil {
+		return err
 	}
-	res, err := utils.Red.ZRevRange(ctx, key, 0, -1).Result()
-	if err != nil {
-		fmt.Println(err)
+	if err := prepareMessage(jsonMsg); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	// 分配会话序号，私聊消息落库，并写入Redis热缓存
+	if err := storeMessage(ctx, privateMsgKey(jsonMsg.UserId, jsonMsg.TargetId), privateMsgQuery(jsonMsg.UserId, jsonMsg.TargetId), jsonMsg); err != nil {
+		return ErrStoreFailed
 	}
-	score := float64(cap(res)) + 1
-	ress, e := utils.Red.ZAdd(ctx, key, &redis.Z{score, msg}).Result() //jsonMsg
-	//res, e := utils.Red.Do(ctx, "zadd", key, 1, jsonMsg).Result() //备用 后续拓展 记录完整msg
-	if e != nil {
-		fmt.Println(e)
-	} else {
-		// 设置4小时过期时间
-		utils.Red.Expire(ctx, key, 4*time.Hour)
+	bumpReplyCount(jsonMsg)
+	msg, _ := jsonMsg.MarshalBinary()
+
+	sendMsgToUser(jsonMsg.TargetId, msg)
+	if jsonMsg.TargetId != jsonMsg.UserId {
+		syncToOtherDevices(jsonMsg.UserId, fromDevice, msg)
 	}
-	fmt.Println(ress)
+	return nil
+}
+
+// 清理客户端不能指定的字段，并校验引用和话题
+func prepareMessage(msg *Message) error {
+	msg.Model = gorm.Model{}
+	msg.CreateTime = uint64(time.Now().Unix())
+	msg.ReadTime = 0
+	msg.EditTime = 0
+	msg.Recalled = false
+	msg.ReplyCount = 0
+	msg.MentionIds = nil
+	msg.MentionAll = false
+	if msg.Media == MediaSystem {
+		// 系统消息只能由服务端生成
+		return ErrBadFrame
+	}
+	return prepareReply(msg)
 }
 
 // 需要重写此方法才能完整的msg转byte[]
@@ -366,49 +426,17 @@ func (msg Message) MarshalBinary() ([]byte, error) {
 	return json.Marshal(msg)
 }
 
-// 获取缓存里面的消息
+// 获取缓存里面的消息，缓存未命中时回源MySQL
 func RedisMsg(userIdA int64, userIdB int64, start int64, end int64, isRev bool) []string {
-	rwLocker.RLock()
-	//node, ok := clientMap[userIdA]
-	rwLocker.RUnlock()
-	//jsonMsg := Message{}
-	//json.Unmarshal(msg, &jsonMsg)
 	ctx := context.Background()
-	userIdStr := strconv.Itoa(int(userIdA))
-	targetIdStr := strconv.Itoa(int(userIdB))
-	var key string
-	if userIdA > userIdB {
-		key = "msg_" + targetIdStr + "_" + userIdStr
-	} else {
-		key = "msg_" + userIdStr + "_" + targetIdStr
-	}
-	//key = "msg_" + userIdStr + "_" + targetIdStr
-	//rels, err := utils.Red.ZRevRange(ctx, key, 0, 10).Result()  //根据score倒叙
-
-	var rels []string
-	var err error
-	if isRev {
-		rels, err = utils.Red.ZRange(ctx, key, start, end).Result()
-	} else {
-		rels, err = utils.Red.ZRevRange(ctx, key, start, end).Result()
-	}
-	if err != nil {
-		fmt.Println(err) //没有找到
-	}
-	// 发送推送消息
-	/**
-	// 后台通过websoket 推送消息
-	for _, val := range rels {
-		fmt.Println("sendMsg >>> userID: ", userIdA, "  msg:", val)
-		node.DataQueue <- []byte(val)
-	}**/
-	return rels
+	return loadHistory(ctx, privateMsgKey(userIdA, userIdB), privateMsgQuery(userIdA, userIdB), start, end, isRev)
 }
 
-// 更新用户心跳
+// 更新用户心跳，同时延长读超时
 func (node *Node) Heartbeat(currentTime uint64) {
-	node.HeartbeatTime = currentTime
-	return
+	node.HeartbeatTime.Store(currentTime)
+	node.Conn.SetReadDeadline(time.Now().Add(pongWait()))
+	saveDevice(node)
 }
 
 // 清理超时连接
@@ -419,14 +447,11 @@ func CleanConnection(param interface{}) (result bool) {
 			fmt.Println("cleanConnection err", r)
 		}
 	}()
-	//fmt.Println("定时任务,清理超时连接 ", param)
-	//node.IsHeartbeatTimeOut()
 	currentTime := uint64(time.Now().Unix())
-	for i := range clientMap {
-		node := clientMap[i]
+	for _, node := range allNodes() {
 		if node.IsHeartbeatTimeOut(currentTime) {
-			fmt.Println("心跳超时..... 关闭连接：", node)
-			node.Conn.Close()
+			fmt.Println("心跳超时..... 关闭连接：", node.UserId, node.DeviceId)
+			node.Close()
 		}
 	}
 	return result
@@ -434,29 +459,17 @@ func CleanConnection(param interface{}) (result bool) {
 
 // 用户心跳是否超时
 func (node *Node) IsHeartbeatTimeOut(currentTime uint64) (timeout bool) {
-	if node.HeartbeatTime+viper.GetUint64("timeout.HeartbeatMaxTime") <= currentTime {
-		fmt.Println("心跳超时。。。自动下线", node)
+	if node.HeartbeatTime.Load()+viper.GetUint64("timeout.HeartbeatMaxTime") <= currentTime {
+		fmt.Println("心跳超时。。。自动下线", node.UserId, node.DeviceId)
 		timeout = true
 	}
 	return
 }
 
-// 获取群聊缓存消息
+// 获取群聊缓存消息，缓存未命中时回源MySQL
 func RedisGroupMsg(groupId int64, start int64, end int64, isRev bool) []string {
 	ctx := context.Background()
-	groupKey := "group_msg_" + strconv.Itoa(int(groupId))
-
-	var rels []string
-	var err error
-	if isRev {
-		rels, err = utils.Red.ZRange(ctx, groupKey, start, end).Result()
-	} else {
-		rels, err = utils.Red.ZRevRange(ctx, groupKey, start, end).Result()
-	}
-	if err != nil {
-		fmt.Println("获取群聊历史消息失败:", err)
-	} else {
-		fmt.Println("获取群聊历史消息成功，消息数量:", len(rels))
-	}
+	rels := loadHistory(ctx, groupMsgKey(groupId), groupMsgQuery(groupId), start, end, isRev)
+	fmt.Println("获取群聊历史消息成功，消息数量:", len(rels))
 	return rels
 }
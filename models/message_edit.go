@@ -0,0 +1,207 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"simple-chatroom/utils"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// 消息编辑记录  保存每次编辑前的内容
+type MessageEdit struct {
+	ID       uint `gorm:"primarykey"`
+	MsgId    uint `gorm:"index"`
+	EditorId int64
+	Content  string //编辑前的内容
+	EditTime uint64
+}
+
+func (table *MessageEdit) TableName() string {
+	return "message_edit"
+}
+
+var (
+	ErrMsgNotFound   = &ChatError{"msg_not_found", "消息不存在"}
+	ErrNoPermission  = &ChatError{"no_permission", "没有权限"}
+	ErrRecallExpired = &ChatError{"recall_expired", "已超过可撤回时间"}
+	ErrMsgRecalled   = &ChatError{"msg_recalled", "消息已撤回"}
+	ErrEmptyContent  = &ChatError{"empty_content", "消息内容不能为空"}
+)
+
+// 撤回时限  单位秒
+func recallWindow() uint64 {
+	n := viper.GetUint64("chat.recallWindow")
+	if n == 0 {
+		n = 120
+	}
+	return n
+}
+
+// 查找可操作的消息（私聊或群聊）  群系统消息不允许编辑、撤回、置顶等操作
+func findChatMessage(msgId uint) (*Message, error) {
+	msg := Message{}
+	utils.DB.Where("id = ? and type in ?", msgId, []int{MsgTypePrivate, MsgTypeGroup}).First(&msg)
+	if msg.ID == 0 || msg.Media == MediaSystem {
+		return nil, ErrMsgNotFound
+	}
+	return &msg, nil
+}
+
+// 撤回消息：发送者在时限内可撤回，群主/管理员可随时撤回群消息
+func RecallMessage(operatorId int64, msgId uint) (*Message, error) {
+	msg, err := findChatMessage(msgId)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Recalled {
+		return nil, ErrMsgRecalled
+	}
+	// 已退群/被移出的成员不能再操作群里的消息
+	if !isParticipant(operatorId, msg) {
+		return nil, ErrNoPermission
+	}
+	// 私聊被拉黑或已不是好友时不能再操作
+	if msg.Type == MsgTypePrivate {
+		if err := checkPrivateSend(operatorId, otherParty(operatorId, msg)); err != nil {
+			return nil, err
+		}
+	}
+	now := uint64(time.Now().Unix())
+	if msg.UserId == operatorId {
+		if msg.CreateTime+recallWindow() < now {
+			return nil, ErrRecallExpired
+		}
+	} else if msg.Type != MsgTypeGroup || !canRecallOthers(operatorId, msg.TargetId) {
+		return nil, ErrNoPermission
+	}
+
+	msg.Recalled = true
+	msg.Content = ""
+	msg.Pic = ""
+	msg.Url = ""
+	err = utils.DB.Model(msg).Updates(map[string]interface{}{"recalled": true, "content": "", "pic": "", "url": ""}).Error
+	if err != nil {
+		fmt.Println("撤回消息失败:", err)
+		return nil, ErrStoreFailed
+	}
+	refreshCachedMessage(msg)
+	broadcastUpdate(msg, MsgTypeRecall, operatorId)
+	return msg, nil
+}
+
+// 编辑消息：只有发送者可以编辑，编辑前的内容记入历史
+func EditMessage(operatorId int64, msgId uint, content string) (*Message, error) {
+	if content == "" {
+		return nil, ErrEmptyContent
+	}
+	msg, err := findChatMessage(msgId)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Recalled {
+		return nil, ErrMsgRecalled
+	}
+	if msg.UserId != operatorId || !isParticipant(operatorId, msg) {
+		return nil, ErrNoPermission
+	}
+	// 编辑等同于重新发送，同样受禁言、拉黑和好友关系限制
+	if err := checkConversationSend(operatorId, msg); err != nil {
+		return nil, err
+	}
+
+	now := uint64(time.Now().Unix())
+	tx := utils.DB.Begin()
+	if err := tx.Create(&MessageEdit{MsgId: msg.ID, EditorId: operatorId, Content: msg.Content, EditTime: now}).Error; err != nil {
+		tx.Rollback()
+		return nil, ErrStoreFailed
+	}
+	if err := tx.Model(msg).Updates(map[string]interface{}{"content": content, "edit_time": now}).Error; err != nil {
+		tx.Rollback()
+		return nil, ErrStoreFailed
+	}
+	tx.Commit()
+
+	msg.Content = content
+	msg.EditTime = now
+	refreshCachedMessage(msg)
+	broadcastUpdate(msg, MsgTypeEdit, operatorId)
+	return msg, nil
+}
+
+// 消息编辑历史，仅会话参与者可查看
+func MessageEditHistory(userId int64, msgId uint) ([]MessageEdit, error) {
+	msg, err := findChatMessage(msgId)
+	if err != nil {
+		return nil, err
+	}
+	if !isParticipant(userId, msg) {
+		return nil, ErrNoPermission
+	}
+	edits := make([]MessageEdit, 0)
+	utils.DB.Where("msg_id = ?", msgId).Order("id asc").Find(&edits)
+	return edits, nil
+}
+
+// 是否为消息所在会话的参与者
+func isParticipant(userId int64, msg *Message) bool {
+	if msg.Type == MsgTypeGroup {
+		return IsGroupMember(uint(userId), uint(msg.TargetId))
+	}
+	return msg.UserId == userId || msg.TargetId == userId
+}
+
+// 私聊中的另一方
+func otherParty(userId int64, msg *Message) int64 {
+	if msg.UserId == userId {
+		return msg.TargetId
+	}
+	return msg.UserId
+}
+
+// 按会话类型校验发送权限
+func checkConversationSend(userId int64, msg *Message) error {
+	if msg.Type == MsgTypeGroup {
+		return checkGroupSend(userId, msg.TargetId)
+	}
+	return checkPrivateSend(userId, otherParty(userId, msg))
+}
+
+// 会话的所有参与者
+func participants(msg *Message) []int64 {
+	if msg.Type == MsgTypeGroup {
+		ids := make([]int64, 0)
+		for _, id := range SearchUserByGroupId(uint(msg.TargetId)) {
+			ids = append(ids, int64(id))
+		}
+		return ids
+	}
+	return []int64{msg.UserId, msg.TargetId}
+}
+
+// 通知会话所有参与者更新消息，frame 内携带更新后的完整消息
+// 保留原消息的发送者和消息类型，Amount 为操作者，Desc 为会话类型
+func broadcastUpdate(msg *Message, eventType int, operatorId int64) {
+	event := *msg
+	event.Type = eventType
+	event.MsgId = msg.ID
+	event.Amount = int(operatorId)
+	event.Desc = strconv.Itoa(msg.Type)
+	data, _ := event.MarshalBinary()
+	for _, id := range participants(msg) {
+		sendMsgToUser(id, data)
+	}
+}
+
+// 刷新热缓存中的消息
+func refreshCachedMessage(msg *Message) {
+	ctx := context.Background()
+	key := conversationKey(msg)
+	if n, _ := utils.Red.Exists(ctx, key).Result(); n == 0 {
+		return
+	}
+	// cacheMessage 会先删除同一序号的旧版本
+	cacheMessage(ctx, key, conversationQuery(msg), msg)
+}
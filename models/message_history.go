@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"simple-chatroom/utils"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// 历史消息分页结果
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	NextCursor int64     `json:"next_cursor"` //下一页的游标（本页最后一条消息的序号）
+	HasMore    bool      `json:"has_more"`
+}
+
+// 按序号游标分页读取会话消息
+// before=true 读取序号小于 cursor 的更早消息（从新到旧），cursor<=0 表示从最新一条开始
+// before=false 读取序号大于 cursor 的更新消息（从旧到新）
+func MessageHistory(ctx context.Context, key string, query *gorm.DB, cursor int64, before bool, limit int) MessagePage {
+	msgs, ok := historyFromCache(ctx, key, cursor, before, limit)
+	if !ok {
+		msgs = historyFromDB(query, cursor, before, limit)
+	}
+	return newMessagePage(msgs, cursor, limit)
+}
+
+// 组装分页结果，msgs 最多比 limit 多取一条用于判断是否还有更多
+func newMessagePage(msgs []Message, cursor int64, limit int) MessagePage {
+	page := MessagePage{Messages: msgs, NextCursor: cursor}
+	if len(msgs) > limit {
+		page.Messages = msgs[:limit]
+		page.HasMore = true
+	}
+	if n := len(page.Messages); n > 0 {
+		page.NextCursor = page.Messages[n-1].Seq
+	}
+	attachReactions(page.Messages)
+	return page
+}
+
+// 私聊历史消息
+func PrivateMsgHistory(userIdA int64, userIdB int64, cursor int64, before bool, limit int) MessagePage {
+	ctx := context.Background()
+	return MessageHistory(ctx, privateMsgKey(userIdA, userIdB), privateMsgQuery(userIdA, userIdB), cursor, before, limit)
+}
+
+// 群聊历史消息
+func GroupMsgHistory(groupId int64, cursor int64, before bool, limit int) MessagePage {
+	ctx := context.Background()
+	return MessageHistory(ctx, groupMsgKey(groupId), groupMsgQuery(groupId), cursor, before, limit)
+}
+
+// 从热缓存读取，缓存不能完整覆盖所请求的区间时返回 false
+// 缓存里总是连续的最近消息，条数未达上限时即为完整会话
+func historyFromCache(ctx context.Context, key string, cursor int64, before bool, limit int) ([]Message, bool) {
+	total, err := utils.Red.ZCard(ctx, key).Result()
+	if err != nil || total == 0 {
+		return nil, false
+	}
+	full := total < msgCacheSize()
+	oldest, err := utils.Red.ZRangeWithScores(ctx, key, 0, 0).Result()
+	if err != nil || len(oldest) == 0 {
+		return nil, false
+	}
+	minSeq := int64(oldest[0].Score)
+
+	var rels []string
+	if before {
+		max := "+inf"
+		if cursor > 0 {
+			max = "(" + strconv.FormatInt(cursor, 10)
+		}
+		rels, err = utils.Red.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: max, Count: int64(limit) + 1}).Result()
+		if err != nil || (len(rels) <= limit && !full) {
+			return nil, false
+		}
+	} else {
+		if !full && cursor+1 < minSeq {
+			return nil, false
+		}
+		min := "(" + strconv.FormatInt(cursor, 10)
+		rels, err = utils.Red.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: min, Max: "+inf", Count: int64(limit) + 1}).Result()
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	msgs := make([]Message, 0, len(rels))
+	for _, r := range rels {
+		m := Message{}
+		if err := json.Unmarshal([]byte(r), &m); err != nil {
+			fmt.Println("缓存消息解析失败:", err)
+			continue
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, true
+}
+
+// 从MySQL读取
+func historyFromDB(query *gorm.DB, cursor int64, before bool, limit int) []Message {
+	msgs := make([]Message, 0)
+	if before {
+		tx := query
+		if cursor > 0 {
+			tx = tx.Where("seq < ?", cursor)
+		}
+		tx.Order("seq desc").Limit(limit + 1).Find(&msgs)
+	} else {
+		query.Where("seq > ?", cursor).Order("seq asc").Limit(limit + 1).Find(&msgs)
+	}
+	return msgs
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"html"
+	"simple-chatroom/utils"
+	"strings"
+	"unicode/utf8"
+)
+
+// 消息搜索条件
+type MessageSearch struct {
+	Keyword  string
+	SenderId int64 //发送者
+	Type     int   //会话类型  1私聊 2群聊，0 为不限
+	TargetId int64 //会话对象  私聊为对方用户ID，群聊为群ID
+	Media    int   //消息类型，0 为不限
+	Start    int64 //开始时间（Unix 秒）
+	End      int64 //结束时间（Unix 秒）
+	Cursor   int64 //上一页最后一条消息的ID
+	Limit    int
+}
+
+// 搜索结果
+type SearchHit struct {
+	Message Message `json:"message"`
+	Snippet string  `json:"snippet"` //关键字用 <em> 高亮的摘要，已做 HTML 转义
+}
+
+// 转义 LIKE 通配符，单字关键词按字面匹配
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// 搜索用户可见的消息：自己参与的私聊和已加入的群
+// 关键字两个字以上时走 FULLTEXT（ngram 分词，支持中文），否则退化为 LIKE
+func SearchMessages(userId int64, q MessageSearch) ([]SearchHit, int64, bool) {
+	keyword := strings.TrimSpace(q.Keyword)
+	hits := make([]SearchHit, 0)
+	if keyword == "" {
+		return hits, q.Cursor, false
+	}
+
+	groupIds := make([]int64, 0)
+	utils.DB.Model(&Contact{}).Where("owner_id = ? and type=2", userId).Pluck("target_id", &groupIds)
+	if len(groupIds) == 0 {
+		groupIds = append(groupIds, 0)
+	}
+
+	tx := utils.DB.Model(&Message{}).
+		Where("((type = 1 and (user_id = ? or target_id = ?)) or (type = 2 and target_id in ?))", userId, userId, groupIds).
+		Where("recalled = ?", false)
+	if utf8.RuneCountInString(keyword) >= 2 {
+		tx = tx.Where("MATCH(content) AGAINST(? IN BOOLEAN MODE)", `"`+strings.ReplaceAll(keyword, `"`, "")+`"`)
+	} else {
+		tx = tx.Where("content like ?", "%"+likeEscaper.Replace(keyword)+"%")
+	}
+	switch q.Type {
+	case MsgTypePrivate:
+		tx = tx.Where("type = 1 and ((user_id = ? and target_id = ?) or (user_id = ? and target_id = ?))", userId, q.TargetId, q.TargetId, userId)
+	case MsgTypeGroup:
+		tx = tx.Where("type = 2 and target_id = ?", q.TargetId)
+	}
+	if q.SenderId != 0 {
+		tx = tx.Where("user_id = ?", q.SenderId)
+	}
+	if q.Media != 0 {
+		tx = tx.Where("media = ?", q.Media)
+	}
+	if q.Start > 0 {
+		tx = tx.Where("create_time >= ?", q.Start)
+	}
+	if q.End > 0 {
+		tx = tx.Where("create_time <= ?", q.End)
+	}
+	if q.Cursor > 0 {
+		tx = tx.Where("id < ?", q.Cursor)
+	}
+
+	msgs := make([]Message, 0)
+	tx.Order("id desc").Limit(q.Limit + 1).Find(&msgs)
+	hasMore := len(msgs) > q.Limit
+	if hasMore {
+		msgs = msgs[:q.Limit]
+	}
+	next := q.Cursor
+	if n := len(msgs); n > 0 {
+		next = int64(msgs[n-1].ID)
+	}
+	for _, m := range msgs {
+		hits = append(hits, SearchHit{Message: m, Snippet: HighlightSnippet(m.Content, keyword, 20)})
+	}
+	return hits, next, hasMore
+}
+
+// 截取关键字前后 radius 个字作为摘要，并用 <em> 标出所有命中的关键字
+func HighlightSnippet(content string, keyword string, radius int) string {
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	key := []rune(strings.ToLower(keyword))
+	if len(key) == 0 || len(lower) != len(runes) {
+		return html.EscapeString(content)
+	}
+
+	first := indexRunes(lower, key, 0)
+	if first < 0 {
+		first = 0
+	}
+	from := first - radius
+	if from < 0 {
+		from = 0
+	}
+	to := first + len(key) + radius
+	if to > len(runes) {
+		to = len(runes)
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("...")
+	}
+	for i := from; i < to; {
+		if i+len(key) <= to && matchAt(lower, key, i) {
+			b.WriteString("<em>" + html.EscapeString(string(runes[i:i+len(key)])) + "</em>")
+			i += len(key)
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+		i++
+	}
+	if to < len(runes) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
+
+// 在 s 中从 from 开始查找 sub，找不到返回 -1
+func indexRunes(s []rune, sub []rune, from int) int {
+	for i := from; i+len(sub) <= len(s); i++ {
+		if matchAt(s, sub, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// s 在位置 i 处是否以 sub 开头
+func matchAt(s []rune, sub []rune, i int) bool {
+	if i+len(sub) > len(s) {
+		return false
+	}
+	for k := range sub {
+		if s[i+k] != sub[k] {
+			return false
+		}
+	}
+	return true
+}
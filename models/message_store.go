@@ -0,0 +1,190 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"simple-chatroom/utils"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 私聊缓存key  id小的在前
+func privateMsgKey(userIdA int64, userIdB int64) string {
+	if userIdA > userIdB {
+		userIdA, userIdB = userIdB, userIdA
+	}
+	return "msg_" + strconv.FormatInt(userIdA, 10) + "_" + strconv.FormatInt(userIdB, 10)
+}
+
+// 群聊缓存key
+func groupMsgKey(groupId int64) string {
+	return "group_msg_" + strconv.FormatInt(groupId, 10)
+}
+
+// 消息所在会话的缓存key
+func conversationKey(msg *Message) string {
+	if msg.Type == MsgTypeGroup {
+		return groupMsgKey(msg.TargetId)
+	}
+	return privateMsgKey(msg.UserId, msg.TargetId)
+}
+
+// 消息所在会话的查询条件
+func conversationQuery(msg *Message) *gorm.DB {
+	if msg.Type == MsgTypeGroup {
+		return groupMsgQuery(msg.TargetId)
+	}
+	return privateMsgQuery(msg.UserId, msg.TargetId)
+}
+
+// 缓存过期时间  单位H
+func msgCacheTTL() time.Duration {
+	h := viper.GetInt("timeout.RedisMsgTime")
+	if h <= 0 {
+		h = 4
+	}
+	return time.Duration(h) * time.Hour
+}
+
+// 每个会话缓存的最大消息条数
+func msgCacheSize() int64 {
+	n := viper.GetInt64("cache.msgSize")
+	if n <= 0 {
+		n = 200
+	}
+	return n
+}
+
+// 私聊消息查询条件
+func privateMsgQuery(userIdA int64, userIdB int64) *gorm.DB {
+	return utils.DB.Model(&Message{}).Where("type = 1 and ((user_id = ? and target_id = ?) or (user_id = ? and target_id = ?))",
+		userIdA, userIdB, userIdB, userIdA).Session(&gorm.Session{})
+}
+
+// 群聊消息查询条件
+func groupMsgQuery(groupId int64) *gorm.DB {
+	return utils.DB.Model(&Message{}).Where("type = 2 and target_id = ?", groupId).Session(&gorm.Session{})
+}
+
+// 分配会话内严格递增的序号，序号计数器丢失时从MySQL中的最大序号恢复
+func nextSeq(ctx context.Context, key string, query *gorm.DB) int64 {
+	seqKey := "seq_" + key
+	if n, err := utils.Red.Exists(ctx, seqKey).Result(); err == nil && n == 0 {
+		var maxSeq int64
+		query.Select("coalesce(max(seq), 0)").Scan(&maxSeq)
+		utils.Red.SetNX(ctx, seqKey, maxSeq, 0)
+	}
+	seq, err := utils.Red.Incr(ctx, seqKey).Result()
+	if err != nil {
+		fmt.Println("Redis Incr error:", err)
+		var maxSeq int64
+		query.Select("coalesce(max(seq), 0)").Scan(&maxSeq)
+		return maxSeq + 1
+	}
+	return seq
+}
+
+// 分配序号、落库并写入缓存
+func storeMessage(ctx context.Context, key string, query *gorm.DB, msg *Message) error {
+	msg.Seq = nextSeq(ctx, key, query)
+	if err := SaveMessage(msg); err != nil {
+		return err
+	}
+	cacheMessage(ctx, key, query, msg)
+	return nil
+}
+
+// 消息落库
+func SaveMessage(msg *Message) error {
+	if msg.CreateTime == 0 {
+		msg.CreateTime = uint64(time.Now().Unix())
+	}
+	err := utils.DB.Create(msg).Error
+	if err != nil {
+		fmt.Println("消息保存到MySQL失败:", err)
+	}
+	return err
+}
+
+// 写入会话热缓存，只保留最近的 msgCacheSize 条
+func cacheMessage(ctx context.Context, key string, query *gorm.DB, msg *Message) {
+	// 缓存已过期则整体从MySQL重建，保证缓存里始终是连续的最近消息
+	if n, _ := utils.Red.Exists(ctx, key).Result(); n == 0 {
+		warmMsgCache(ctx, key, query)
+		return
+	}
+	// 并发预热可能已经写入了同一序号的消息，先按 score 删除再写入，避免重复
+	score := strconv.FormatInt(msg.Seq, 10)
+	pipe := utils.Red.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, score, score)
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(msg.Seq), Member: msg})
+	pipe.ZRemRangeByRank(ctx, key, 0, -msgCacheSize()-1)
+	pipe.Expire(ctx, key, msgCacheTTL())
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Println("Redis ZAdd error:", err)
+	}
+}
+
+// 缓存失效后从MySQL加载最近的消息预热
+func warmMsgCache(ctx context.Context, key string, query *gorm.DB) {
+	msgs := make([]Message, 0)
+	query.Order("seq desc, id desc").Limit(int(msgCacheSize())).Find(&msgs)
+	if len(msgs) == 0 {
+		return
+	}
+	zs := make([]*redis.Z, 0, len(msgs))
+	for i := range msgs {
+		zs = append(zs, &redis.Z{Score: float64(msgs[i].Seq), Member: msgs[i]})
+	}
+	if err := utils.Red.ZAdd(ctx, key, zs...).Err(); err != nil {
+		fmt.Println("Redis 预热缓存失败:", err)
+		return
+	}
+	utils.Red.Expire(ctx, key, msgCacheTTL())
+}
+
+// 按排名读取历史消息：优先走Redis，缓存窗口覆盖不到时回源MySQL
+func loadHistory(ctx context.Context, key string, query *gorm.DB, start int64, end int64, isRev bool) []string {
+	total, err := utils.Red.ZCard(ctx, key).Result()
+	if err != nil {
+		fmt.Println("Redis ZCard error:", err)
+	}
+	if total == 0 {
+		warmMsgCache(ctx, key, query)
+		total, _ = utils.Red.ZCard(ctx, key).Result()
+	}
+	// 倒序读取时缓存里是最近的消息，排名直接可用；正序需要缓存里是完整会话
+	if end >= 0 && end < total && (!isRev || total < msgCacheSize()) {
+		var rels []string
+		if isRev {
+			rels, err = utils.Red.ZRange(ctx, key, start, end).Result()
+		} else {
+			rels, err = utils.Red.ZRevRange(ctx, key, start, end).Result()
+		}
+		if err == nil {
+			return rels
+		}
+		fmt.Println("Redis 读取历史消息失败:", err)
+	}
+
+	order := "seq desc, id desc"
+	if isRev {
+		order = "seq asc, id asc"
+	}
+	limit := -1
+	if end >= 0 {
+		limit = int(end - start + 1)
+	}
+	msgs := make([]Message, 0)
+	query.Order(order).Offset(int(start)).Limit(limit).Find(&msgs)
+	rels := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		b, _ := m.MarshalBinary()
+		rels = append(rels, string(b))
+	}
+	return rels
+}
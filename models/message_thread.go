@@ -0,0 +1,66 @@
+package models
+
+import (
+	"simple-chatroom/utils"
+
+	"gorm.io/gorm"
+)
+
+var ErrBadReply = &ChatError{"bad_reply", "引用的消息不在当前会话"}
+
+// 消息是否属于 msg 所在的会话
+func sameConversation(ref *Message, msg *Message) bool {
+	if ref.Type != msg.Type {
+		return false
+	}
+	if msg.Type == MsgTypeGroup {
+		return ref.TargetId == msg.TargetId
+	}
+	return (ref.UserId == msg.UserId && ref.TargetId == msg.TargetId) ||
+		(ref.UserId == msg.TargetId && ref.TargetId == msg.UserId)
+}
+
+// 校验引用回复和话题  回复话题内的消息时归入同一个话题
+func prepareReply(msg *Message) error {
+	if msg.ReplyTo != 0 {
+		ref, err := findChatMessage(msg.ReplyTo)
+		if err != nil || !sameConversation(ref, msg) {
+			return ErrBadReply
+		}
+	}
+	if msg.ThreadId != 0 {
+		root, err := findChatMessage(msg.ThreadId)
+		if err != nil || !sameConversation(root, msg) {
+			return ErrBadReply
+		}
+		if root.ThreadId != 0 {
+			msg.ThreadId = root.ThreadId
+		}
+	}
+	return nil
+}
+
+// 话题根消息回复数加一，并刷新缓存
+func bumpReplyCount(msg *Message) {
+	if msg.ThreadId == 0 {
+		return
+	}
+	utils.DB.Model(&Message{}).Where("id = ?", msg.ThreadId).Update("reply_count", gorm.Expr("reply_count + 1"))
+	if root, err := findChatMessage(msg.ThreadId); err == nil {
+		refreshCachedMessage(root)
+	}
+}
+
+// 话题内的回复，按序号游标分页
+func ThreadHistory(userId int64, threadId uint, cursor int64, before bool, limit int) (MessagePage, error) {
+	root, err := findChatMessage(threadId)
+	if err != nil {
+		return MessagePage{}, err
+	}
+	if !isParticipant(userId, root) {
+		return MessagePage{}, ErrNoPermission
+	}
+	query := conversationQuery(root).Where("thread_id = ?", threadId)
+	msgs := historyFromDB(query, cursor, before, limit)
+	return newMessagePage(msgs, cursor, limit), nil
+}
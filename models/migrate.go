@@ -0,0 +1,33 @@
+package models
+
+import (
+	"fmt"
+	"simple-chatroom/utils"
+)
+
+// 同步表结构  只会新增缺失的表、列和索引，不会删除已有数据
+func Migrate() {
+	err := utils.DB.AutoMigrate(
+		&UserBasic{},
+		&Contact{},
+		&Community{},
+		&GroupBasic{},
+		&Message{},
+		&MessageReceipt{},
+		&ReadCursor{},
+		&MessageEdit{},
+		&MessageReaction{},
+		&MessageMention{},
+		&FriendRequest{},
+		&GroupJoinRequest{},
+		&GroupInvite{},
+		&GroupBan{},
+		&GroupAnnouncement{},
+		&GroupAnnouncementEdit{},
+		&GroupAnnouncementRead{},
+		&GroupPin{},
+	)
+	if err != nil {
+		fmt.Println("同步表结构失败:", err)
+	}
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"simple-chatroom/utils"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 在线状态
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+// 用户在线状态
+type Presence struct {
+	UserId   int64  `json:"user_id"`
+	Status   string `json:"status"`
+	LastSeen int64  `json:"last_seen"` //最后在线时间
+}
+
+func presenceKey(userId int64) string {
+	return "presence_" + strconv.FormatInt(userId, 10)
+}
+
+// 用户第一台设备上线
+func userOnline(userId int64) {
+	utils.DB.Model(&UserBasic{}).Where("id = ?", userId).
+		Updates(map[string]interface{}{"login_time": time.Now(), "heartbeat_time": time.Now(), "is_logout": false})
+	setPresence(userId, PresenceOnline)
+}
+
+// 用户最后一台设备下线
+func userOffline(userId int64) {
+	utils.DB.Model(&UserBasic{}).Where("id = ?", userId).
+		Updates(map[string]interface{}{"login_out_time": time.Now(), "heartbeat_time": time.Now(), "is_logout": true})
+	setPresence(userId, PresenceOffline)
+}
+
+// 客户端主动切换 在线/离开
+func changePresence(userId int64, status string) error {
+	if status != PresenceOnline && status != PresenceAway {
+		return ErrBadFrame
+	}
+	setPresence(userId, status)
+	return nil
+}
+
+// 记录在线状态，状态变化时通知好友
+func setPresence(userId int64, status string) {
+	ctx := context.Background()
+	key := presenceKey(userId)
+	old, _ := utils.Red.HGet(ctx, key, "status").Result()
+	now := time.Now().Unix()
+	err := utils.Red.HSet(ctx, key, "status", status, "last_seen", now).Err()
+	if err != nil {
+		fmt.Println("在线状态保存失败:", err)
+		return
+	}
+	if old != status {
+		notifyPresence(Presence{UserId: userId, Status: status, LastSeen: now})
+	}
+}
+
+// 推送在线状态变化给好友
+func notifyPresence(p Presence) {
+	event := Message{
+		UserId:     p.UserId,
+		Type:       MsgTypePresence,
+		Content:    p.Status,
+		CreateTime: uint64(p.LastSeen),
+	}
+	data, _ := event.MarshalBinary()
+	blocked := blockedIds(uint(p.UserId))
+	for _, friendId := range friendIds(uint(p.UserId)) {
+		// 被拉黑的用户看不到在线状态
+		if blocked[friendId] {
+			continue
+		}
+		pushToUser(int64(friendId), data)
+	}
+}
+
+// 单次批量查询在线状态的最大人数
+const maxPresenceBatch = 200
+
+// 批量查询在线状态  只返回好友（和自己）的真实状态，其他用户及拉黑了查询者的好友始终显示离线
+// 状态记录缺失或已没有实例持有连接的（实例异常退出）按离线处理
+func GetPresence(viewerId uint, userIds []int64) []Presence {
+	if len(userIds) > maxPresenceBatch {
+		userIds = userIds[:maxPresenceBatch]
+	}
+	visible := map[int64]bool{int64(viewerId): true}
+	for _, id := range friendIds(viewerId) {
+		visible[int64(id)] = true
+	}
+	ids := make([]uint, 0, len(userIds))
+	for _, id := range userIds {
+		if visible[id] {
+			ids = append(ids, uint(id))
+		}
+	}
+	for id := range blockedBy(viewerId, ids) {
+		visible[int64(id)] = false
+	}
+
+	ctx := context.Background()
+	pipe := utils.Red.Pipeline()
+	cmds := make(map[int64]*redis.StringStringMapCmd, len(ids))
+	for _, id := range ids {
+		cmds[int64(id)] = pipe.HGetAll(ctx, presenceKey(int64(id)))
+	}
+	if len(cmds) > 0 {
+		pipe.Exec(ctx)
+	}
+
+	res := make([]Presence, 0, len(userIds))
+	for _, id := range userIds {
+		p := Presence{UserId: id, Status: PresenceOffline}
+		if !visible[id] {
+			res = append(res, p)
+			continue
+		}
+		if m, err := cmds[id].Result(); err == nil && len(m) > 0 {
+			p.Status = m["status"]
+			p.LastSeen, _ = strconv.ParseInt(m["last_seen"], 10, 64)
+		}
+		if p.Status != PresenceOffline && !hasRoute(id) {
+			p.Status = PresenceOffline
+		}
+		if p.LastSeen == 0 {
+			user := FindByID(uint(id))
+			if !user.LoginOutTime.IsZero() {
+				p.LastSeen = user.LoginOutTime.Unix()
+			}
+		}
+		res = append(res, p)
+	}
+	return res
+}
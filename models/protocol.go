@@ -0,0 +1,95 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 信封协议版本，连接时带上 v=1 或发送信封格式的帧即启用
+const ProtocolVersion = 1
+
+// 信封操作类型
+const (
+	OpSend  = "send"  //客户端发送消息
+	OpAck   = "ack"   //服务端确认，携带分配的消息ID和序号
+	OpError = "error" //服务端返回错误
+	OpPush  = "push"  //服务端推送
+)
+
+// 信封  客户端通过 Id 关联服务端的确认或错误
+type Envelope struct {
+	V       int             `json:"v"`
+	Op      string          `json:"op"`
+	Id      string          `json:"id,omitempty"`
+	Seq     int64           `json:"seq,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Error   *ChatError      `json:"error,omitempty"`
+}
+
+// 发送确认的内容
+type AckPayload struct {
+	MsgId    uint  `json:"msg_id"`
+	Seq      int64 `json:"seq"`
+	Type     int   `json:"type"`
+	TargetId int64 `json:"target_id"`
+}
+
+// 兼容旧格式的错误帧
+type errorFrame struct {
+	Type       int    `json:"Type"`
+	Code       string `json:"Code"`
+	Msg        string `json:"Msg"`
+	CreateTime uint64 `json:"CreateTime"`
+}
+
+var envelopePrefix = []byte(`{"v":`)
+
+// 解析客户端帧，带 op 字段的为信封格式，否则按旧格式的 Message 处理
+func ParseFrame(data []byte) (*Envelope, Message, error) {
+	msg := Message{}
+	env := Envelope{}
+	if err := json.Unmarshal(data, &env); err == nil && env.Op != "" {
+		if env.Op != OpSend || len(env.Payload) == 0 {
+			return &env, msg, ErrBadFrame
+		}
+		err := json.Unmarshal(env.Payload, &msg)
+		return &env, msg, err
+	}
+	err := json.Unmarshal(data, &msg)
+	return nil, msg, err
+}
+
+// 把推送的数据包装成信封，已经是信封的原样返回
+func WrapPush(data []byte) []byte {
+	if bytes.HasPrefix(data, envelopePrefix) {
+		return data
+	}
+	var head struct {
+		Seq int64 `json:"Seq"`
+	}
+	json.Unmarshal(data, &head)
+	b, _ := json.Marshal(Envelope{V: ProtocolVersion, Op: OpPush, Seq: head.Seq, Payload: data})
+	return b
+}
+
+// 回复发送者：成功时回确认，失败时回错误
+// 旧格式客户端只在失败时收到错误帧
+func (node *Node) reply(corrId string, msg *Message, e *ChatError) {
+	var data []byte
+	switch {
+	case node.Envelope.Load() && e != nil:
+		data, _ = json.Marshal(Envelope{V: ProtocolVersion, Op: OpError, Id: corrId, Error: e})
+	case node.Envelope.Load() && msg != nil:
+		payload, _ := json.Marshal(AckPayload{MsgId: msg.ID, Seq: msg.Seq, Type: msg.Type, TargetId: msg.TargetId})
+		data, _ = json.Marshal(Envelope{V: ProtocolVersion, Op: OpAck, Id: corrId, Seq: msg.Seq, Payload: payload})
+	case e != nil:
+		data, _ = json.Marshal(errorFrame{Type: MsgTypeError, Code: e.Code, Msg: e.Msg, CreateTime: uint64(time.Now().Unix())})
+	default:
+		return
+	}
+	if !node.enqueue(data) {
+		fmt.Println("用户消息队列已满，回复丢弃: ", node.UserId)
+	}
+}
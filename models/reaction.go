@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"simple-chatroom/utils"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// 表情回应
+type MessageReaction struct {
+	ID         uint   `gorm:"primarykey"`
+	MsgId      uint   `gorm:"uniqueIndex:idx_reaction_msg_user_emoji"`
+	UserId     int64  `gorm:"uniqueIndex:idx_reaction_msg_user_emoji"`
+	Emoji      string `gorm:"type:varchar(32);uniqueIndex:idx_reaction_msg_user_emoji"`
+	CreateTime uint64
+}
+
+func (table *MessageReaction) TableName() string {
+	return "message_reaction"
+}
+
+// 某个表情的回应汇总
+type ReactionSummary struct {
+	Emoji   string  `json:"emoji"`
+	Count   int     `json:"count"`
+	UserIds []int64 `json:"user_ids"`
+}
+
+const (
+	ReactionAdd    = "add"
+	ReactionRemove = "remove"
+)
+
+var ErrBadEmoji = &ChatError{"bad_emoji", "表情不合法"}
+
+// 添加或取消表情回应，并通知会话所有参与者
+func ReactMessage(userId int64, msgId uint, emoji string, add bool) error {
+	if emoji == "" || len(emoji) > 32 {
+		return ErrBadEmoji
+	}
+	msg, err := findChatMessage(msgId)
+	if err != nil {
+		return err
+	}
+	if msg.Recalled {
+		return ErrMsgRecalled
+	}
+	if !isParticipant(userId, msg) {
+		return ErrNoPermission
+	}
+	if msg.Type == MsgTypePrivate {
+		if err := checkPrivateSend(userId, otherParty(userId, msg)); err != nil {
+			return err
+		}
+	}
+
+	now := uint64(time.Now().Unix())
+	action := ReactionAdd
+	if add {
+		err = utils.DB.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&MessageReaction{MsgId: msgId, UserId: userId, Emoji: emoji, CreateTime: now}).Error
+	} else {
+		action = ReactionRemove
+		err = utils.DB.Where("msg_id = ? and user_id = ? and emoji = ?", msgId, userId, emoji).Delete(&MessageReaction{}).Error
+	}
+	if err != nil {
+		fmt.Println("表情回应保存失败:", err)
+		return ErrStoreFailed
+	}
+
+	event := Message{
+		UserId:     userId,
+		TargetId:   msg.TargetId,
+		Type:       MsgTypeReaction,
+		Media:      msg.Type, //Media 为会话类型
+		Content:    emoji,
+		Desc:       action,
+		MsgId:      msgId,
+		Seq:        msg.Seq,
+		CreateTime: now,
+		Reactions:  reactionsOf([]uint{msgId})[msgId],
+	}
+	data, _ := event.MarshalBinary()
+	for _, id := range participants(msg) {
+		sendMsgToUser(id, data)
+	}
+	return nil
+}
+
+// 批量查询消息的表情回应汇总
+func reactionsOf(msgIds []uint) map[uint][]ReactionSummary {
+	res := make(map[uint][]ReactionSummary)
+	if len(msgIds) == 0 {
+		return res
+	}
+	rows := make([]MessageReaction, 0)
+	utils.DB.Where("msg_id in ?", msgIds).Order("id asc").Find(&rows)
+	for _, r := range rows {
+		list := res[r.MsgId]
+		found := false
+		for i := range list {
+			if list[i].Emoji == r.Emoji {
+				list[i].Count++
+				list[i].UserIds = append(list[i].UserIds, r.UserId)
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, ReactionSummary{Emoji: r.Emoji, Count: 1, UserIds: []int64{r.UserId}})
+		}
+		res[r.MsgId] = list
+	}
+	return res
+}
+
+// 给消息列表填充表情回应
+func attachReactions(msgs []Message) {
+	ids := make([]uint, 0, len(msgs))
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+	}
+	reactions := reactionsOf(ids)
+	for i := range msgs {
+		msgs[i].Reactions = reactions[msgs[i].ID]
+	}
+}
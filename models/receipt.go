@@ -0,0 +1,199 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"simple-chatroom/utils"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm/clause"
+)
+
+// 消息回执  记录每个接收者对某条消息的送达和已读时间
+type MessageReceipt struct {
+	ID          uint   `gorm:"primarykey"`
+	MsgId       uint   `gorm:"uniqueIndex:idx_receipt_msg_user"`
+	UserId      int64  `gorm:"uniqueIndex:idx_receipt_msg_user"`
+	DeliverTime uint64 //送达时间
+	ReadTime    uint64 //读取时间
+}
+
+func (table *MessageReceipt) TableName() string {
+	return "message_receipt"
+}
+
+// 会话已读位置  用于统计未读数
+type ReadCursor struct {
+	ID       uint  `gorm:"primarykey"`
+	UserId   int64 `gorm:"uniqueIndex:idx_read_cursor"`
+	Type     int   `gorm:"uniqueIndex:idx_read_cursor"` //会话类型  1私聊  2群聊
+	TargetId int64 `gorm:"uniqueIndex:idx_read_cursor"` //对方用户ID / 群ID
+	ReadSeq  int64 //已读到的消息序号
+	ReadTime uint64
+}
+
+func (table *ReadCursor) TableName() string {
+	return "read_cursor"
+}
+
+// 会话未读数
+type UnreadCount struct {
+	Type     int   `json:"type"`
+	TargetId int64 `json:"target_id"`
+	Unread   int64 `json:"unread"`
+}
+
+// 处理客户端发来的送达/已读回执：落库后转发给消息的发送者
+func handleReceipt(ack Message) error {
+	msg := Message{}
+	utils.DB.Where("id = ?", ack.MsgId).First(&msg)
+	if msg.ID == 0 {
+		return ErrMsgNotFound
+	}
+	// 只有消息的接收者才能回执
+	if msg.UserId == ack.UserId {
+		return ErrNoPermission
+	}
+	switch msg.Type {
+	case MsgTypePrivate:
+		if msg.TargetId != ack.UserId {
+			return ErrNoPermission
+		}
+	case MsgTypeGroup:
+		if !IsGroupMember(uint(ack.UserId), uint(msg.TargetId)) {
+			return ErrNotMember
+		}
+	default:
+		return ErrMsgNotFound
+	}
+
+	now := uint64(time.Now().Unix())
+	receipt := MessageReceipt{MsgId: msg.ID, UserId: ack.UserId}
+	updates := []string{}
+	if ack.Type == MsgTypeDelivered {
+		receipt.DeliverTime = now
+		updates = append(updates, "deliver_time")
+	} else {
+		receipt.DeliverTime = now
+		receipt.ReadTime = now
+		updates = append(updates, "read_time")
+		markRead(ack.UserId, msg, now)
+	}
+	err := utils.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "msg_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns(updates),
+	}).Create(&receipt).Error
+	if err != nil {
+		fmt.Println("消息回执保存失败:", err)
+		return ErrStoreFailed
+	}
+
+	// 转发给原发送者，发送者不在线时由历史消息中的 ReadTime 补齐状态
+	event := Message{
+		UserId:     ack.UserId,
+		TargetId:   msg.UserId,
+		Type:       ack.Type,
+		MsgId:      msg.ID,
+		Seq:        msg.Seq,
+		CreateTime: now,
+	}
+	if ack.Type == MsgTypeRead {
+		event.ReadTime = now
+	}
+	data, _ := event.MarshalBinary()
+	pushToUser(msg.UserId, data)
+	return nil
+}
+
+// 推进会话已读位置，私聊同时给此前未读的消息写入 ReadTime
+func markRead(userId int64, msg Message, now uint64) {
+	targetId := msg.TargetId
+	if msg.Type == MsgTypePrivate {
+		targetId = msg.UserId
+		res := utils.DB.Model(&Message{}).
+			Where("type = 1 and user_id = ? and target_id = ? and seq <= ? and read_time = 0", msg.UserId, userId, msg.Seq).
+			Update("read_time", now)
+		if res.Error == nil && res.RowsAffected > 0 {
+			markCachedRead(privateMsgKey(msg.UserId, userId), msg.UserId, msg.Seq, now)
+		}
+	}
+	cursor := ReadCursor{UserId: userId, Type: msg.Type, TargetId: targetId, ReadSeq: msg.Seq, ReadTime: now}
+	err := utils.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "type"}, {Name: "target_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"read_seq":  clause.Expr{SQL: "GREATEST(read_seq, VALUES(read_seq))"},
+			"read_time": now,
+		}),
+	}).Create(&cursor).Error
+	if err != nil {
+		fmt.Println("已读位置保存失败:", err)
+	}
+}
+
+// 同步热缓存里的已读时间  只改写 seq 之前由 senderId 发出且未读的消息
+func markCachedRead(key string, senderId int64, seq int64, now uint64) {
+	ctx := context.Background()
+	zs, err := utils.Red.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(seq, 10)}).Result()
+	if err != nil {
+		fmt.Println("Redis 读取缓存消息失败:", err)
+		return
+	}
+	pipe := utils.Red.TxPipeline()
+	changed := false
+	for _, z := range zs {
+		member, _ := z.Member.(string)
+		m := Message{}
+		if json.Unmarshal([]byte(member), &m) != nil || m.UserId != senderId || m.ReadTime != 0 {
+			continue
+		}
+		m.ReadTime = now
+		pipe.ZRem(ctx, key, member)
+		pipe.ZAdd(ctx, key, &redis.Z{Score: z.Score, Member: m})
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		// 改写失败时删除缓存，下次读取从MySQL重建
+		fmt.Println("Redis 更新已读状态失败:", err)
+		utils.Red.Del(ctx, key)
+	}
+}
+
+// 每个会话的未读消息数
+func UnreadCounts(userId uint) []UnreadCount {
+	res := make([]UnreadCount, 0)
+
+	// 私聊：发给我的且未读的消息
+	rows := make([]UnreadCount, 0)
+	utils.DB.Model(&Message{}).
+		Select("1 as type, user_id as target_id, count(*) as unread").
+		Where("type = 1 and target_id = ? and read_time = 0", userId).
+		Group("user_id").Scan(&rows)
+	res = append(res, rows...)
+
+	// 群聊：已读位置之后别人发的消息
+	cursors := make([]ReadCursor, 0)
+	utils.DB.Where("user_id = ? and type = 2", userId).Find(&cursors)
+	readSeq := make(map[int64]int64, len(cursors))
+	for _, c := range cursors {
+		readSeq[c.TargetId] = c.ReadSeq
+	}
+	contacts := make([]Contact, 0)
+	utils.DB.Where("owner_id = ? and type=2", userId).Find(&contacts)
+	for _, v := range contacts {
+		groupId := int64(v.TargetId)
+		var n int64
+		utils.DB.Model(&Message{}).
+			Where("type = 2 and target_id = ? and user_id <> ? and seq > ?", groupId, userId, readSeq[groupId]).
+			Count(&n)
+		if n > 0 {
+			res = append(res, UnreadCount{Type: MsgTypeGroup, TargetId: groupId, Unread: n})
+		}
+	}
+	return res
+}
@@ -0,0 +1,261 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"simple-chatroom/utils"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// 写超时
+const writeWait = 10 * time.Second
+
+// 读超时  单位秒，超过此时间未收到任何数据（含 pong）即断开
+func pongWait() time.Duration {
+	n := viper.GetInt("timeout.PongWait")
+	if n <= 0 {
+		n = 60
+	}
+	return time.Duration(n) * time.Second
+}
+
+// ping 间隔，需小于读超时
+func pingPeriod() time.Duration {
+	return pongWait() * 9 / 10
+}
+
+// 在线设备信息
+type DeviceSession struct {
+	DeviceId      string `json:"device_id"`
+	DeviceInfo    string `json:"device_info"`
+	Addr          string `json:"addr"`
+	LoginTime     uint64 `json:"login_time"`
+	HeartbeatTime uint64 `json:"heartbeat_time"`
+	Instance      string `json:"instance"` //连接所在的实例
+}
+
+// 用户在所有实例上的设备登记  field 为 实例ID/设备ID
+func deviceKey(userId int64) string {
+	return "devices_" + strconv.FormatInt(userId, 10)
+}
+
+func deviceField(node *Node) string {
+	return instanceId + "/" + node.DeviceId
+}
+
+// 连接的设备信息
+func (node *Node) session() DeviceSession {
+	return DeviceSession{
+		DeviceId:      node.DeviceId,
+		DeviceInfo:    node.DeviceInfo,
+		Addr:          node.Addr,
+		LoginTime:     node.LoginTime,
+		HeartbeatTime: node.HeartbeatTime.Load(),
+		Instance:      instanceId,
+	}
+}
+
+// 登记/刷新设备信息，供其他实例查询设备列表
+func saveDevice(node *Node) {
+	data, _ := json.Marshal(node.session())
+	ctx := context.Background()
+	if err := utils.Red.HSet(ctx, deviceKey(node.UserId), deviceField(node), data).Err(); err != nil {
+		fmt.Println("设备信息保存失败:", err)
+	}
+}
+
+// 登记连接，同一设备重复登录时关闭旧连接
+func registerNode(node *Node) {
+	rwLocker.Lock()
+	devices, ok := clientMap[node.UserId]
+	if !ok {
+		devices = make(map[string]*Node)
+		clientMap[node.UserId] = devices
+	}
+	old := devices[node.DeviceId]
+	devices[node.DeviceId] = node
+	rwLocker.Unlock()
+	addRoute(node.UserId)
+	saveDevice(node)
+
+	if old != nil && old != node {
+		old.Close()
+	}
+}
+
+// 注销连接，只移除仍然是当前登记的那个连接，返回用户在本实例上是否已没有连接
+func removeNode(node *Node) bool {
+	rwLocker.Lock()
+	devices, ok := clientMap[node.UserId]
+	if !ok || devices[node.DeviceId] != node {
+		rwLocker.Unlock()
+		return false
+	}
+	delete(devices, node.DeviceId)
+	last := len(devices) == 0
+	if last {
+		delete(clientMap, node.UserId)
+	}
+	rwLocker.Unlock()
+	utils.Red.HDel(context.Background(), deviceKey(node.UserId), deviceField(node))
+	if last {
+		delRoute(node.UserId)
+	}
+	return last
+}
+
+// 补发离线消息期间最多暂存的实时消息条数
+const pendingSize = 500
+
+// 放入发送队列，队列已满或连接已关闭时返回 false
+// 离线消息补发期间实时消息先暂存，补发完成后按顺序放入队列
+func (node *Node) enqueue(data []byte) bool {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if node.closed {
+		return false
+	}
+	if node.flushing {
+		if len(node.pending) >= pendingSize {
+			return false
+		}
+		node.pending = append(node.pending, data)
+		return true
+	}
+	return node.push(data)
+}
+
+// 直接写入发送队列，调用方需持有 node.mu
+func (node *Node) push(data []byte) bool {
+	select {
+	case node.DataQueue <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// 补发期间写入发送队列，不经过暂存
+func (node *Node) enqueueFlush(data []byte) bool {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	if node.closed {
+		return false
+	}
+	return node.push(data)
+}
+
+// 连接是否已关闭
+func (node *Node) isClosed() bool {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	return node.closed
+}
+
+// 离线消息补发完成：把暂存的实时消息依次放入队列，全部放完后恢复直接投递
+// 队列持续占满或连接已关闭时，剩余消息放回收件箱
+func (node *Node) finishFlush() {
+	for {
+		node.mu.Lock()
+		batch := node.pending
+		node.pending = nil
+		if len(batch) == 0 {
+			node.flushing = false
+			node.mu.Unlock()
+			return
+		}
+		node.mu.Unlock()
+		for i, data := range batch {
+			if !enqueueWait(node, data, 5*time.Second) {
+				for _, rest := range batch[i:] {
+					saveToInbox(node.UserId, rest)
+				}
+				break
+			}
+		}
+	}
+}
+
+// 关闭连接：从注册表移除、关闭发送队列，用户所有设备都下线时清理在线状态
+// 发送和接收协程退出时都会调用，只执行一次
+func (node *Node) Close() {
+	node.mu.Lock()
+	if node.closed {
+		node.mu.Unlock()
+		return
+	}
+	node.closed = true
+	close(node.DataQueue)
+	node.mu.Unlock()
+
+	node.Conn.Close()
+	if removeNode(node) && !hasRoute(node.UserId) {
+		ctx := context.Background()
+		utils.Red.Del(ctx, "online_"+strconv.FormatInt(node.UserId, 10))
+		userOffline(node.UserId)
+	}
+	fmt.Println("连接已关闭: ", node.UserId, node.DeviceId)
+}
+
+// 用户的所有在线连接
+func userNodes(userId int64) []*Node {
+	rwLocker.RLock()
+	defer rwLocker.RUnlock()
+	devices := clientMap[userId]
+	nodes := make([]*Node, 0, len(devices))
+	for _, node := range devices {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// 所有在线连接
+func allNodes() []*Node {
+	rwLocker.RLock()
+	defer rwLocker.RUnlock()
+	nodes := make([]*Node, 0, len(clientMap))
+	for _, devices := range clientMap {
+		for _, node := range devices {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// 用户当前登录的设备列表  包括其他实例上的连接
+func UserDevices(userId int64) []DeviceSession {
+	nodes := userNodes(userId)
+	res := make([]DeviceSession, 0, len(nodes))
+	for _, node := range nodes {
+		res = append(res, node.session())
+	}
+
+	ctx := context.Background()
+	entries, err := utils.Red.HGetAll(ctx, deviceKey(userId)).Result()
+	if err != nil {
+		fmt.Println("读取设备列表失败:", err)
+		return res
+	}
+	instances, _ := utils.Red.SMembers(ctx, routeKey(userId)).Result()
+	alive := make(map[string]bool, len(instances))
+	for _, id := range instances {
+		alive[id] = true
+	}
+	for field, v := range entries {
+		d := DeviceSession{}
+		if err := json.Unmarshal([]byte(v), &d); err != nil || d.Instance == instanceId {
+			continue
+		}
+		if !alive[d.Instance] {
+			// 实例已下线，清理残留登记
+			utils.Red.HDel(ctx, deviceKey(userId), field)
+			continue
+		}
+		res = append(res, d)
+	}
+	return res
+}
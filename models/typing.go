@@ -0,0 +1,97 @@
+package models
+
+import (
+	"context"
+	"simple-chatroom/utils"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// 正在输入状态
+const (
+	TypingStart = "start"
+	TypingStop  = "stop"
+)
+
+// 同一会话两次 start 的最小间隔  单位秒
+func typingInterval() time.Duration {
+	n := viper.GetInt("chat.typingInterval")
+	if n <= 0 {
+		n = 2
+	}
+	return time.Duration(n) * time.Second
+}
+
+// 接收方在没有收到 stop 时自动清除输入状态的时间  单位秒
+func typingTTL() int {
+	n := viper.GetInt("chat.typingTTL")
+	if n <= 0 {
+		n = 6
+	}
+	return n
+}
+
+// 转发正在输入状态，只推送给在线用户，不落库也不进离线收件箱
+func sendTyping(msg *Message) error {
+	if msg.Content != TypingStart && msg.Content != TypingStop {
+		return ErrBadFrame
+	}
+	// Media 标识会话类型  1私聊  2群聊，其他值按私聊处理，归一化后再限流
+	if msg.Media != MsgTypeGroup {
+		msg.Media = MsgTypePrivate
+	}
+	if !allowTyping(msg) {
+		return nil
+	}
+
+	event := Message{
+		UserId:     msg.UserId,
+		TargetId:   msg.TargetId,
+		Type:       MsgTypeTyping,
+		Media:      msg.Media,
+		Content:    msg.Content,
+		Amount:     typingTTL(),
+		CreateTime: uint64(time.Now().Unix()),
+	}
+	switch msg.Media {
+	case MsgTypeGroup:
+		if err := checkGroupSend(msg.UserId, msg.TargetId); err != nil {
+			return err
+		}
+		data, _ := event.MarshalBinary()
+		for _, id := range SearchUserByGroupId(uint(msg.TargetId)) {
+			if int64(id) != msg.UserId {
+				pushToUser(int64(id), data)
+			}
+		}
+	default:
+		if err := checkPrivateSend(msg.UserId, msg.TargetId); err != nil {
+			return err
+		}
+		data, _ := event.MarshalBinary()
+		pushToUser(msg.TargetId, data)
+	}
+	return nil
+}
+
+// 按发送者和会话限流：间隔内重复的 start 直接丢弃，stop 只在之前转发过 start 时才转发
+// 这样 start / stop 交替发送时每个间隔最多转发一对
+func allowTyping(msg *Message) bool {
+	ctx := context.Background()
+	key := "typing_" + strconv.FormatInt(msg.UserId, 10) + "_" + strconv.Itoa(msg.Media) + "_" + strconv.FormatInt(msg.TargetId, 10)
+	activeKey := key + "_on"
+	if msg.Content == TypingStop {
+		n, err := utils.Red.Del(ctx, activeKey).Result()
+		return err != nil || n > 0
+	}
+	ok, err := utils.Red.SetNX(ctx, key, 1, typingInterval()).Result()
+	if err != nil {
+		return true
+	}
+	if ok {
+		utils.Red.Set(ctx, activeKey, 1, time.Duration(typingTTL())*time.Second)
+	}
+	return ok
+}
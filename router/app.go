@@ -50,6 +50,8 @@ func Router() *gin.Engine {
 		auth.POST("/user/deleteUser", service.DeleteUser)
 		auth.POST("/user/updateUser", service.UpdateUser)
 		auth.POST("/user/find", service.FindByID)
+		auth.POST("/user/devices", service.UserDevices)
+		auth.POST("/user/presence", service.UserPresence)
 		//发送消息
 		auth.GET("/user/sendMsg", service.SendMsg)
 		//发送消息
@@ -58,6 +60,19 @@ func Router() *gin.Engine {
 
 		//添加好友
 		auth.POST("/contact/addfriend", service.AddFriend)
+		//好友申请
+		auth.POST("/contact/acceptFriend", service.AcceptFriend)
+		auth.POST("/contact/rejectFriend", service.RejectFriend)
+		auth.POST("/contact/cancelFriend", service.CancelFriend)
+		auth.POST("/contact/friendRequests", service.FriendRequests)
+		//删除好友/黑名单
+		auth.POST("/contact/deleteFriend", service.DeleteFriend)
+		auth.POST("/contact/block", service.BlockUser)
+		auth.POST("/contact/unblock", service.UnblockUser)
+		auth.POST("/contact/blockList", service.BlockList)
+		//好友备注/标签/星标
+		auth.POST("/contact/updateFriend", service.UpdateFriend)
+		auth.POST("/contact/friendTags", service.FriendTags)
 		//上传文件
 		auth.POST("/attach/upload", service.Upload)
 		//创建群
@@ -65,10 +80,60 @@ func Router() *gin.Engine {
 		//群列表
 		auth.POST("/contact/loadcommunity", service.LoadCommunity)
 		auth.POST("/contact/joinGroup", service.JoinGroups)
+		//群成员与群管理
+		auth.POST("/group/members", service.GroupMembers)
+		auth.POST("/group/setAdmin", service.SetGroupAdmin)
+		auth.POST("/group/update", service.UpdateCommunity)
+		auth.POST("/group/invite", service.InviteToGroup)
+		auth.POST("/group/kick", service.KickFromGroup)
+		auth.POST("/group/leave", service.LeaveGroup)
+		auth.POST("/group/unban", service.UnbanGroupMember)
+		auth.POST("/group/bans", service.GroupBans)
+		auth.POST("/group/transfer", service.TransferGroup)
+		auth.POST("/group/disband", service.DisbandGroup)
+		//禁言/免打扰
+		auth.POST("/group/mute", service.MuteMember)
+		auth.POST("/group/adminsOnly", service.SetAdminsOnly)
+		auth.POST("/group/notify", service.SetGroupNotify)
+		auth.POST("/group/mutedGroups", service.MutedGroups)
+		//群详情/公告/置顶
+		auth.POST("/group/detail", service.GroupDetail)
+		auth.POST("/group/announce", service.PublishAnnouncement)
+		auth.POST("/group/editAnnouncement", service.EditAnnouncement)
+		auth.POST("/group/deleteAnnouncement", service.DeleteAnnouncement)
+		auth.POST("/group/announcementHistory", service.AnnouncementHistory)
+		auth.POST("/group/readAnnouncement", service.ReadAnnouncement)
+		auth.POST("/group/announcementReaders", service.AnnouncementReaders)
+		auth.POST("/group/pin", service.PinMessage)
+		auth.POST("/group/unpin", service.UnpinMessage)
+		//入群方式/审核/邀请码
+		auth.POST("/group/joinPolicy", service.SetJoinPolicy)
+		auth.POST("/group/joinRequests", service.JoinRequests)
+		auth.POST("/group/acceptJoin", service.AcceptJoinRequest)
+		auth.POST("/group/rejectJoin", service.RejectJoinRequest)
+		auth.POST("/group/cancelJoin", service.CancelJoinRequest)
+		auth.POST("/group/createInvite", service.CreateGroupInvite)
+		auth.POST("/group/revokeInvite", service.RevokeGroupInvite)
+		auth.POST("/group/invites", service.GroupInvites)
+		auth.POST("/group/joinByInvite", service.JoinByInvite)
 		auth.POST("/user/redisMsg", service.RedisMsg)
 		auth.POST("/user/redisGroupMsg", service.RedisGroupMsg)
 
 		auth.POST("/user/redisAIMsg", service.RedisAIMsg)
+		//历史消息（按序号游标分页）
+		auth.POST("/message/history", service.HistoryMsg)
+		auth.POST("/message/aiHistory", service.HistoryAIMsg)
+		auth.POST("/message/thread", service.ThreadMsg)
+		auth.POST("/message/mentions", service.MentionMsg)
+		auth.POST("/message/search", service.SearchMsg)
+		//会话未读数
+		auth.POST("/message/unread", service.UnreadCounts)
+		//撤回/编辑消息
+		auth.POST("/message/recall", service.RecallMsg)
+		auth.POST("/message/edit", service.EditMsg)
+		auth.POST("/message/editHistory", service.MsgEditHistory)
+		//表情回应
+		auth.POST("/message/react", service.ReactMsg)
 
 		//AI聊天
 		auth.POST("/api/ai/chat", service.HandleAIChat)
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"simple-chatroom/models"
+	"simple-chatroom/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 群成员列表（含角色）
+func GroupMembers(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	data, msg := models.GroupMembers(currentUserId(c), uint(groupId))
+	if data == nil {
+		utils.RespFail(c.Writer, msg)
+		return
+	}
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 设置/取消管理员  admin=true 设置，false 取消
+func SetGroupAdmin(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
+	admin, _ := strconv.ParseBool(c.Request.FormValue("admin"))
+	code, msg := models.SetGroupAdmin(currentUserId(c), uint(groupId), uint(targetId), admin)
+	respCodeMsg(c, code, msg)
+}
+
+// 修改群资料
+func UpdateCommunity(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	name := c.Request.FormValue("name")
+	icon := c.Request.FormValue("icon")
+	desc := c.Request.FormValue("desc")
+	code, msg := models.UpdateCommunity(currentUserId(c), uint(groupId), name, icon, desc)
+	respCodeMsg(c, code, msg)
+}
+
+// 邀请用户入群
+func InviteToGroup(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
+	code, msg := models.InviteToGroup(currentUserId(c), uint(groupId), uint(targetId))
+	respCodeMsg(c, code, msg)
+}
+
+// 移除群成员  ban=true 时同时拉入群黑名单
+func KickFromGroup(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
+	ban, _ := strconv.ParseBool(c.Request.FormValue("ban"))
+	code, msg := models.KickFromGroup(currentUserId(c), uint(groupId), uint(targetId), ban)
+	respCodeMsg(c, code, msg)
+}
+
+// 退出群
+func LeaveGroup(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	code, msg := models.LeaveGroup(currentUserId(c), uint(groupId))
+	respCodeMsg(c, code, msg)
+}
+
+// 解除群黑名单
+func UnbanGroupMember(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
+	code, msg := models.UnbanGroupMember(currentUserId(c), uint(groupId), uint(targetId))
+	respCodeMsg(c, code, msg)
+}
+
+// 群黑名单
+func GroupBans(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	data, msg := models.GroupBans(currentUserId(c), uint(groupId))
+	if data == nil {
+		utils.RespFail(c.Writer, msg)
+		return
+	}
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 转让群主
+func TransferGroup(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
+	code, msg := models.TransferGroup(currentUserId(c), uint(groupId), uint(targetId))
+	respCodeMsg(c, code, msg)
+}
+
+// 解散群
+func DisbandGroup(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	code, msg := models.DisbandGroup(currentUserId(c), uint(groupId))
+	respCodeMsg(c, code, msg)
+}
+
+// 设置入群方式  policy: 0直接加入 1需审核 2仅限邀请
+func SetJoinPolicy(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	policy, _ := strconv.Atoi(c.Request.FormValue("policy"))
+	code, msg := models.SetJoinPolicy(currentUserId(c), uint(groupId), policy)
+	respCodeMsg(c, code, msg)
+}
+
+// 待审核的入群申请
+func JoinRequests(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	data, msg := models.PendingJoinRequests(currentUserId(c), uint(groupId))
+	if data == nil {
+		utils.RespFail(c.Writer, msg)
+		return
+	}
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 同意入群申请
+func AcceptJoinRequest(c *gin.Context) {
+	requestId, _ := strconv.Atoi(c.Request.FormValue("requestId"))
+	code, msg := models.HandleJoinRequest(currentUserId(c), uint(requestId), true)
+	respCodeMsg(c, code, msg)
+}
+
+// 拒绝入群申请
+func RejectJoinRequest(c *gin.Context) {
+	requestId, _ := strconv.Atoi(c.Request.FormValue("requestId"))
+	code, msg := models.HandleJoinRequest(currentUserId(c), uint(requestId), false)
+	respCodeMsg(c, code, msg)
+}
+
+// 撤回自己的入群申请
+func CancelJoinRequest(c *gin.Context) {
+	requestId, _ := strconv.Atoi(c.Request.FormValue("requestId"))
+	code, msg := models.CancelJoinRequest(currentUserId(c), uint(requestId))
+	respCodeMsg(c, code, msg)
+}
+
+// 生成邀请码  expireHours 为 0 永久有效，maxUses 为 0 不限次数
+func CreateGroupInvite(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	expireHours, _ := strconv.Atoi(c.Request.FormValue("expireHours"))
+	maxUses, _ := strconv.Atoi(c.Request.FormValue("maxUses"))
+	invite, msg := models.CreateGroupInvite(currentUserId(c), uint(groupId), expireHours, maxUses)
+	if invite == nil {
+		utils.RespFail(c.Writer, msg)
+		return
+	}
+	utils.RespOK(c.Writer, invite, msg)
+}
+
+// 作废邀请码
+func RevokeGroupInvite(c *gin.Context) {
+	code, msg := models.RevokeGroupInvite(currentUserId(c), c.Request.FormValue("code"))
+	respCodeMsg(c, code, msg)
+}
+
+// 群的有效邀请码
+func GroupInvites(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	data, msg := models.GroupInvites(currentUserId(c), uint(groupId))
+	if data == nil {
+		utils.RespFail(c.Writer, msg)
+		return
+	}
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 通过邀请码入群
+func JoinByInvite(c *gin.Context) {
+	code, msg := models.JoinByInvite(currentUserId(c), c.Request.FormValue("code"))
+	respCodeMsg(c, code, msg)
+}
+
+// 禁言群成员  minutes 为 0 表示解除禁言
+func MuteMember(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
+	minutes, _ := strconv.Atoi(c.Request.FormValue("minutes"))
+	code, msg := models.MuteMember(currentUserId(c), uint(groupId), uint(targetId), minutes)
+	respCodeMsg(c, code, msg)
+}
+
+// 开启/关闭全员禁言
+func SetAdminsOnly(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	on, _ := strconv.ParseBool(c.Request.FormValue("on"))
+	code, msg := models.SetAdminsOnly(currentUserId(c), uint(groupId), on)
+	respCodeMsg(c, code, msg)
+}
+
+// 设置群消息免打扰
+func SetGroupNotify(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	muted, _ := strconv.ParseBool(c.Request.FormValue("muted"))
+	code, msg := models.SetGroupNotifyMuted(currentUserId(c), uint(groupId), muted)
+	respCodeMsg(c, code, msg)
+}
+
+// 开启了免打扰的群
+func MutedGroups(c *gin.Context) {
+	data := models.NotifyMutedGroups(currentUserId(c))
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 群详情  资料、公告和置顶消息
+func GroupDetail(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	data, msg := models.GetGroupDetail(currentUserId(c), uint(groupId))
+	if data == nil {
+		utils.RespFail(c.Writer, msg)
+		return
+	}
+	utils.RespOK(c.Writer, data, msg)
+}
+
+// 发布群公告
+func PublishAnnouncement(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	title := c.Request.FormValue("title")
+	content := c.Request.FormValue("content")
+	data, msg := models.PublishAnnouncement(currentUserId(c), uint(groupId), title, content)
+	if data == nil {
+		utils.RespFail(c.Writer, msg)
+		return
+	}
+	utils.RespOK(c.Writer, data, msg)
+}
+
+// 编辑群公告
+func EditAnnouncement(c *gin.Context) {
+	announcementId, _ := strconv.Atoi(c.Request.FormValue("announcementId"))
+	title := c.Request.FormValue("title")
+	content := c.Request.FormValue("content")
+	data, msg := models.EditAnnouncement(currentUserId(c), uint(announcementId), title, content)
+	if data == nil {
+		utils.RespFail(c.Writer, msg)
+		return
+	}
+	utils.RespOK(c.Writer, data, msg)
+}
+
+// 删除群公告
+func DeleteAnnouncement(c *gin.Context) {
+	announcementId, _ := strconv.Atoi(c.Request.FormValue("announcementId"))
+	code, msg := models.DeleteAnnouncement(currentUserId(c), uint(announcementId))
+	respCodeMsg(c, code, msg)
+}
+
+// 群公告编辑历史
+func AnnouncementHistory(c *gin.Context) {
+	announcementId, _ := strconv.Atoi(c.Request.FormValue("announcementId"))
+	data, msg := models.AnnouncementEditHistory(currentUserId(c), uint(announcementId))
+	if data == nil {
+		utils.RespFail(c.Writer, msg)
+		return
+	}
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 标记群公告已读
+func ReadAnnouncement(c *gin.Context) {
+	announcementId, _ := strconv.Atoi(c.Request.FormValue("announcementId"))
+	code, msg := models.ReadAnnouncement(currentUserId(c), uint(announcementId))
+	respCodeMsg(c, code, msg)
+}
+
+// 群公告已读成员
+func AnnouncementReaders(c *gin.Context) {
+	announcementId, _ := strconv.Atoi(c.Request.FormValue("announcementId"))
+	data, msg := models.AnnouncementReaders(currentUserId(c), uint(announcementId))
+	if data == nil {
+		utils.RespFail(c.Writer, msg)
+		return
+	}
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 置顶群消息
+func PinMessage(c *gin.Context) {
+	msgId, _ := strconv.Atoi(c.Request.FormValue("msgId"))
+	code, msg := models.PinMessage(currentUserId(c), uint(msgId))
+	respCodeMsg(c, code, msg)
+}
+
+// 取消置顶
+func UnpinMessage(c *gin.Context) {
+	groupId, _ := strconv.Atoi(c.Request.FormValue("groupId"))
+	msgId, _ := strconv.Atoi(c.Request.FormValue("msgId"))
+	code, msg := models.UnpinMessage(currentUserId(c), uint(groupId), uint(msgId))
+	respCodeMsg(c, code, msg)
+}
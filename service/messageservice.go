@@ -0,0 +1,170 @@
+package service
+
+import (
+	"simple-chatroom/models"
+	"simple-chatroom/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// 解析游标分页参数  cursor 消息序号，direction before/after，limit 条数
+func historyParams(c *gin.Context) (int64, bool, int) {
+	cursor, _ := strconv.ParseInt(c.Request.FormValue("cursor"), 10, 64)
+	before := c.Request.FormValue("direction") != "after"
+	limit, _ := strconv.Atoi(c.Request.FormValue("limit"))
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	return cursor, before, limit
+}
+
+// 会话历史消息  type 1私聊 2群聊，targetId 对方用户ID / 群ID
+func HistoryMsg(c *gin.Context) {
+	userId := currentUserId(c)
+	msgType, _ := strconv.Atoi(c.Request.FormValue("type"))
+	targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
+	cursor, before, limit := historyParams(c)
+
+	switch msgType {
+	case 1:
+		page := models.PrivateMsgHistory(int64(userId), int64(targetId), cursor, before, limit)
+		utils.RespOK(c.Writer, page, "ok")
+	case 2:
+		if !models.IsGroupMember(userId, uint(targetId)) {
+			utils.RespFail(c.Writer, "不是群成员")
+			return
+		}
+		page := models.GroupMsgHistory(int64(targetId), cursor, before, limit)
+		utils.RespOK(c.Writer, page, "ok")
+	default:
+		utils.RespFail(c.Writer, "不支持的会话类型")
+	}
+}
+
+// AI对话历史
+func HistoryAIMsg(c *gin.Context) {
+	cursor, before, limit := historyParams(c)
+	records, next, hasMore := models.AIChatHistoryBySeq(int64(currentUserId(c)), cursor, before, limit)
+	utils.RespOK(c.Writer, gin.H{
+		"records":     records,
+		"next_cursor": next,
+		"has_more":    hasMore,
+	}, "ok")
+}
+
+// 每个会话的未读消息数
+func UnreadCounts(c *gin.Context) {
+	data := models.UnreadCounts(currentUserId(c))
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 返回消息操作结果
+func respMsgResult(c *gin.Context, msg *models.Message, err error) {
+	if err != nil {
+		utils.RespFail(c.Writer, chatErrMsg(err))
+		return
+	}
+	utils.RespOK(c.Writer, msg, "ok")
+}
+
+// 业务错误的提示信息
+func chatErrMsg(err error) string {
+	if e, ok := err.(*models.ChatError); ok {
+		return e.Msg
+	}
+	return err.Error()
+}
+
+// 撤回消息
+func RecallMsg(c *gin.Context) {
+	msgId, _ := strconv.Atoi(c.Request.FormValue("msgId"))
+	msg, err := models.RecallMessage(int64(currentUserId(c)), uint(msgId))
+	respMsgResult(c, msg, err)
+}
+
+// 编辑消息
+func EditMsg(c *gin.Context) {
+	msgId, _ := strconv.Atoi(c.Request.FormValue("msgId"))
+	content := c.Request.FormValue("content")
+	msg, err := models.EditMessage(int64(currentUserId(c)), uint(msgId), content)
+	respMsgResult(c, msg, err)
+}
+
+// 消息编辑历史
+func MsgEditHistory(c *gin.Context) {
+	msgId, _ := strconv.Atoi(c.Request.FormValue("msgId"))
+	data, err := models.MessageEditHistory(int64(currentUserId(c)), uint(msgId))
+	if err != nil {
+		utils.RespFail(c.Writer, chatErrMsg(err))
+		return
+	}
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 话题内的回复  threadId 为话题根消息ID
+func ThreadMsg(c *gin.Context) {
+	threadId, _ := strconv.Atoi(c.Request.FormValue("threadId"))
+	cursor, before, limit := historyParams(c)
+	page, err := models.ThreadHistory(int64(currentUserId(c)), uint(threadId), cursor, before, limit)
+	if err != nil {
+		utils.RespFail(c.Writer, chatErrMsg(err))
+		return
+	}
+	utils.RespOK(c.Writer, page, "ok")
+}
+
+// 表情回应  action 为 add / remove
+func ReactMsg(c *gin.Context) {
+	msgId, _ := strconv.Atoi(c.Request.FormValue("msgId"))
+	emoji := c.Request.FormValue("emoji")
+	add := c.Request.FormValue("action") != models.ReactionRemove
+	if err := models.ReactMessage(int64(currentUserId(c)), uint(msgId), emoji, add); err != nil {
+		utils.RespFail(c.Writer, chatErrMsg(err))
+		return
+	}
+	utils.RespOK(c.Writer, nil, "ok")
+}
+
+// 提到我的消息  cursor 为上一页最后一条消息的ID
+func MentionMsg(c *gin.Context) {
+	cursor, _, limit := historyParams(c)
+	msgs, next, hasMore := models.MentionsOfMe(int64(currentUserId(c)), cursor, limit)
+	utils.RespOK(c.Writer, gin.H{
+		"messages":    msgs,
+		"next_cursor": next,
+		"has_more":    hasMore,
+	}, "ok")
+}
+
+// 搜索历史消息
+// keyword 关键字，senderId 发送者，type/targetId 会话，media 消息类型，start/end 时间范围（Unix 秒）
+func SearchMsg(c *gin.Context) {
+	cursor, _, limit := historyParams(c)
+	q := models.MessageSearch{
+		Keyword: c.Request.FormValue("keyword"),
+		Cursor:  cursor,
+		Limit:   limit,
+	}
+	q.SenderId, _ = strconv.ParseInt(c.Request.FormValue("senderId"), 10, 64)
+	q.Type, _ = strconv.Atoi(c.Request.FormValue("type"))
+	q.TargetId, _ = strconv.ParseInt(c.Request.FormValue("targetId"), 10, 64)
+	q.Media, _ = strconv.Atoi(c.Request.FormValue("media"))
+	q.Start, _ = strconv.ParseInt(c.Request.FormValue("start"), 10, 64)
+	q.End, _ = strconv.ParseInt(c.Request.FormValue("end"), 10, 64)
+
+	hits, next, hasMore := models.SearchMessages(int64(currentUserId(c)), q)
+	utils.RespOK(c.Writer, gin.H{
+		"hits":        hits,
+		"next_cursor": next,
+		"has_more":    hasMore,
+	}, "ok")
+}
@@ -9,3 +9,8 @@ import (
 func JWTAuth() func(c *gin.Context) {
 	return models.JWTAuthMiddleware()
 }
+
+// 当前登录用户ID，由JWT中间件写入上下文
+func currentUserId(c *gin.Context) uint {
+	return uint(c.GetInt("userID"))
+}
@@ -13,6 +13,7 @@ import (
 	"simple-chatroom/models"
 	"simple-chatroom/utils"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/asaskevich/govalidator"
@@ -236,8 +237,9 @@ func SendMsg(c *gin.Context) {
 	MsgHandler(c, ws)
 }
 
+// 获取私聊历史消息  userIdA 固定为当前登录用户
 func RedisMsg(c *gin.Context) {
-	userIdA, _ := strconv.Atoi(c.PostForm("userIdA"))
+	userIdA := currentUserId(c)
 	userIdB, _ := strconv.Atoi(c.PostForm("userIdB"))
 	start, _ := strconv.Atoi(c.PostForm("start"))
 	end, _ := strconv.Atoi(c.PostForm("end"))
@@ -249,6 +251,10 @@ func RedisMsg(c *gin.Context) {
 // 获取群聊历史消息
 func RedisGroupMsg(c *gin.Context) {
 	groupId, _ := strconv.Atoi(c.PostForm("groupId"))
+	if !models.IsGroupMember(currentUserId(c), uint(groupId)) {
+		utils.RespFail(c.Writer, "不是群成员")
+		return
+	}
 	start, _ := strconv.Atoi(c.PostForm("start"))
 	end, _ := strconv.Atoi(c.PostForm("end"))
 	isRev, _ := strconv.ParseBool(c.PostForm("isRev"))
@@ -258,7 +264,7 @@ func RedisGroupMsg(c *gin.Context) {
 
 // 获取AI对话历史消息
 func RedisAIMsg(c *gin.Context) {
-	userID, _ := strconv.Atoi(c.PostForm("userId"))
+	userID := currentUserId(c)
 	start, _ := strconv.Atoi(c.PostForm("start"))
 	end, _ := strconv.Atoi(c.PostForm("end"))
 	isRev, _ := strconv.ParseBool(c.PostForm("isRev"))
@@ -286,8 +292,7 @@ func SendUserMsg(c *gin.Context) {
 	models.Chat(c.Writer, c.Request)
 }
 func SearchFriends(c *gin.Context) {
-	id, _ := strconv.Atoi(c.Request.FormValue("userId"))
-	users := models.SearchFriend(uint(id))
+	users := models.SearchFriend(currentUserId(c), c.Request.FormValue("sort"), c.Request.FormValue("tag"))
 	// c.JSON(200, gin.H{
 	// 	"code":    0, //  0成功   -1失败
 	// 	"message": "查询好友列表成功！",
@@ -296,11 +301,12 @@ func SearchFriends(c *gin.Context) {
 	utils.RespOKList(c.Writer, users, len(users))
 }
 
+// 发起好友申请  greeting 为附带的招呼语
 func AddFriend(c *gin.Context) {
-	userId, _ := strconv.Atoi(c.Request.FormValue("userId"))
 	targetName := c.Request.FormValue("targetName")
+	greeting := c.Request.FormValue("greeting")
 	//targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
-	code, msg := models.AddFriend(uint(userId), targetName)
+	code, msg := models.AddFriend(currentUserId(c), targetName, greeting)
 	if code == 0 {
 		utils.RespOK(c.Writer, code, msg)
 	} else {
@@ -310,12 +316,11 @@ func AddFriend(c *gin.Context) {
 
 // 新建群
 func CreateCommunity(c *gin.Context) {
-	ownerId, _ := strconv.Atoi(c.Request.FormValue("ownerId"))
 	name := c.Request.FormValue("name")
 	icon := c.Request.FormValue("icon")
 	desc := c.Request.FormValue("desc")
 	community := models.Community{}
-	community.OwnerId = uint(ownerId)
+	community.OwnerId = currentUserId(c)
 	community.Name = name
 	community.Img = icon
 	community.Desc = desc
@@ -341,11 +346,11 @@ func LoadCommunity(c *gin.Context) {
 
 // 加入群 userId uint, comId uint
 func JoinGroups(c *gin.Context) {
-	userId, _ := strconv.Atoi(c.Request.FormValue("userId"))
 	comId := c.Request.FormValue("comId")
+	reason := c.Request.FormValue("reason")
 
 	//	name := c.Request.FormValue("name")
-	data, msg := models.JoinGroup(uint(userId), comId)
+	data, msg := models.JoinGroup(currentUserId(c), comId, reason)
 	if data == 0 {
 		utils.RespOK(c.Writer, data, msg)
 	} else {
@@ -360,3 +365,113 @@ func FindByID(c *gin.Context) {
 	data := models.FindByID(uint(userId))
 	utils.RespOK(c.Writer, data, "ok")
 }
+
+// 当前用户已登录的设备列表
+func UserDevices(c *gin.Context) {
+	data := models.UserDevices(int64(currentUserId(c)))
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 批量查询在线状态  userIds 以逗号分隔
+func UserPresence(c *gin.Context) {
+	ids := make([]int64, 0)
+	for _, v := range strings.Split(c.Request.FormValue("userIds"), ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	data := models.GetPresence(currentUserId(c), ids)
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 处理好友申请的返回
+func respCodeMsg(c *gin.Context, code int, msg string) {
+	if code == 0 {
+		utils.RespOK(c.Writer, code, msg)
+	} else {
+		utils.RespFail(c.Writer, msg)
+	}
+}
+
+// 同意好友申请
+func AcceptFriend(c *gin.Context) {
+	requestId, _ := strconv.Atoi(c.Request.FormValue("requestId"))
+	code, msg := models.AcceptFriendRequest(currentUserId(c), uint(requestId))
+	respCodeMsg(c, code, msg)
+}
+
+// 拒绝好友申请
+func RejectFriend(c *gin.Context) {
+	requestId, _ := strconv.Atoi(c.Request.FormValue("requestId"))
+	code, msg := models.RejectFriendRequest(currentUserId(c), uint(requestId))
+	respCodeMsg(c, code, msg)
+}
+
+// 撤回好友申请
+func CancelFriend(c *gin.Context) {
+	requestId, _ := strconv.Atoi(c.Request.FormValue("requestId"))
+	code, msg := models.CancelFriendRequest(currentUserId(c), uint(requestId))
+	respCodeMsg(c, code, msg)
+}
+
+// 好友申请列表  box 为 in（收到的）或 out（发出的）
+func FriendRequests(c *gin.Context) {
+	incoming := c.Request.FormValue("box") != "out"
+	data := models.ListFriendRequests(currentUserId(c), incoming)
+	utils.RespOKList(c.Writer, data, len(data))
+}
+
+// 删除好友
+func DeleteFriend(c *gin.Context) {
+	targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
+	code, msg := models.DeleteFriend(currentUserId(c), uint(targetId))
+	respCodeMsg(c, code, msg)
+}
+
+// 拉黑用户
+func BlockUser(c *gin.Context) {
+	targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
+	code, msg := models.BlockUser(currentUserId(c), uint(targetId))
+	respCodeMsg(c, code, msg)
+}
+
+// 取消拉黑
+func UnblockUser(c *gin.Context) {
+	targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
+	code, msg := models.UnblockUser(currentUserId(c), uint(targetId))
+	respCodeMsg(c, code, msg)
+}
+
+// 黑名单
+func BlockList(c *gin.Context) {
+	users := models.BlockList(currentUserId(c))
+	utils.RespOKList(c.Writer, users, len(users))
+}
+
+// 修改好友备注、标签和星标  tags 以逗号分隔，未传的字段不修改
+func UpdateFriend(c *gin.Context) {
+	targetId, _ := strconv.Atoi(c.Request.FormValue("targetId"))
+	var remark *string
+	if _, ok := c.Request.Form["remark"]; ok {
+		v := c.Request.FormValue("remark")
+		remark = &v
+	}
+	var tags []string
+	if _, ok := c.Request.Form["tags"]; ok {
+		tags = strings.Split(c.Request.FormValue("tags"), ",")
+	}
+	var starred *bool
+	if _, ok := c.Request.Form["starred"]; ok {
+		v, _ := strconv.ParseBool(c.Request.FormValue("starred"))
+		starred = &v
+	}
+	code, msg := models.UpdateFriend(currentUserId(c), uint(targetId), remark, tags, starred)
+	respCodeMsg(c, code, msg)
+}
+
+// 好友标签列表
+func FriendTags(c *gin.Context) {
+	data := models.FriendTags(currentUserId(c))
+	utils.RespOKList(c.Writer, data, len(data))
+}
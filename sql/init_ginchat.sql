@@ -7,6 +7,8 @@ CREATE TABLE `communities` (
   `owner_id` bigint(20) unsigned DEFAULT NULL,
   `img` longtext,
   `desc` longtext,
+  `join_policy` bigint(20) DEFAULT NULL,
+  `admins_only` tinyint(1) DEFAULT NULL,
   PRIMARY KEY (`id`),
   KEY `idx_communities_deleted_at` (`deleted_at`)
 ) ENGINE=InnoDB AUTO_INCREMENT=18 DEFAULT CHARSET=utf8;
@@ -20,6 +22,11 @@ CREATE TABLE `contact` (
   `target_id` bigint(20) unsigned DEFAULT NULL,
   `type` bigint(20) DEFAULT NULL,
   `desc` longtext,
+  `tags` longtext,
+  `starred` tinyint(1) DEFAULT NULL,
+  `role` bigint(20) DEFAULT NULL,
+  `mute_until` bigint(20) DEFAULT NULL,
+  `notify_muted` tinyint(1) DEFAULT NULL,
   PRIMARY KEY (`id`),
   KEY `idx_contact_deleted_at` (`deleted_at`)
 ) ENGINE=InnoDB AUTO_INCREMENT=185 DEFAULT CHARSET=utf8;
@@ -43,18 +50,32 @@ CREATE TABLE `message` (
   `created_at` datetime(3) DEFAULT NULL,
   `updated_at` datetime(3) DEFAULT NULL,
   `deleted_at` datetime(3) DEFAULT NULL,
-  `form_id` longtext,
-  `target_id` longtext,
-  `type` longtext,
+  `user_id` bigint(20) DEFAULT NULL,
+  `target_id` bigint(20) DEFAULT NULL,
+  `type` bigint(20) DEFAULT NULL,
   `media` bigint(20) DEFAULT NULL,
   `content` longtext,
+  `create_time` bigint(20) unsigned DEFAULT NULL,
+  `read_time` bigint(20) unsigned DEFAULT NULL,
   `pic` longtext,
   `url` longtext,
   `desc` longtext,
   `amount` bigint(20) DEFAULT NULL,
+  `seq` bigint(20) DEFAULT NULL,
+  `edit_time` bigint(20) unsigned DEFAULT NULL,
+  `recalled` tinyint(1) DEFAULT NULL,
+  `reply_to` bigint(20) unsigned DEFAULT NULL,
+  `thread_id` bigint(20) unsigned DEFAULT NULL,
+  `reply_count` bigint(20) DEFAULT NULL,
+  `mention_ids` longtext,
+  `mention_all` tinyint(1) DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `idx_message_deleted_at` (`deleted_at`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+  KEY `idx_message_deleted_at` (`deleted_at`),
+  KEY `idx_message_type_target` (`type`,`target_id`),
+  KEY `idx_message_user_target` (`user_id`,`target_id`),
+  KEY `idx_message_thread_id` (`thread_id`),
+  FULLTEXT KEY `ft_message_content` (`content`) WITH PARSER ngram
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 CREATE TABLE `user_basic` (
   `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
@@ -79,16 +100,166 @@ CREATE TABLE `user_basic` (
   KEY `idx_user_basic_deleted_at` (`deleted_at`)
 ) ENGINE=InnoDB AUTO_INCREMENT=26 DEFAULT CHARSET=utf8;
 
+CREATE TABLE `message_receipt` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `msg_id` bigint(20) unsigned DEFAULT NULL,
+  `user_id` bigint(20) DEFAULT NULL,
+  `deliver_time` bigint(20) unsigned DEFAULT NULL,
+  `read_time` bigint(20) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_receipt_msg_user` (`msg_id`,`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `read_cursor` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) DEFAULT NULL,
+  `type` bigint(20) DEFAULT NULL,
+  `target_id` bigint(20) DEFAULT NULL,
+  `read_seq` bigint(20) DEFAULT NULL,
+  `read_time` bigint(20) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_read_cursor` (`user_id`,`type`,`target_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `message_edit` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `msg_id` bigint(20) unsigned DEFAULT NULL,
+  `editor_id` bigint(20) DEFAULT NULL,
+  `content` longtext,
+  `edit_time` bigint(20) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_message_edit_msg_id` (`msg_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `message_reaction` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `msg_id` bigint(20) unsigned DEFAULT NULL,
+  `user_id` bigint(20) DEFAULT NULL,
+  `emoji` varchar(32) DEFAULT NULL,
+  `create_time` bigint(20) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_reaction_msg_user_emoji` (`msg_id`,`user_id`,`emoji`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `message_mention` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `msg_id` bigint(20) unsigned DEFAULT NULL,
+  `user_id` bigint(20) DEFAULT NULL,
+  `group_id` bigint(20) DEFAULT NULL,
+  `create_time` bigint(20) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_message_mention_msg_id` (`msg_id`),
+  KEY `idx_mention_user` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `friend_request` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  `deleted_at` datetime(3) DEFAULT NULL,
+  `from_id` bigint(20) unsigned DEFAULT NULL,
+  `to_id` bigint(20) unsigned DEFAULT NULL,
+  `greeting` longtext,
+  `status` bigint(20) DEFAULT NULL,
+  `expire_time` datetime(3) DEFAULT NULL,
+  `handle_time` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_friend_request_deleted_at` (`deleted_at`),
+  KEY `idx_friend_request_from_id` (`from_id`),
+  KEY `idx_friend_request_to_id` (`to_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `group_join_request` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  `deleted_at` datetime(3) DEFAULT NULL,
+  `community_id` bigint(20) unsigned DEFAULT NULL,
+  `user_id` bigint(20) unsigned DEFAULT NULL,
+  `reason` longtext,
+  `status` bigint(20) DEFAULT NULL,
+  `handler_id` bigint(20) unsigned DEFAULT NULL,
+  `handle_time` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_group_join_request_deleted_at` (`deleted_at`),
+  KEY `idx_group_join_request_community_id` (`community_id`),
+  KEY `idx_group_join_request_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `group_invite` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  `deleted_at` datetime(3) DEFAULT NULL,
+  `community_id` bigint(20) unsigned DEFAULT NULL,
+  `creator_id` bigint(20) unsigned DEFAULT NULL,
+  `code` varchar(32) DEFAULT NULL,
+  `expire_time` datetime(3) DEFAULT NULL,
+  `max_uses` bigint(20) DEFAULT NULL,
+  `uses` bigint(20) DEFAULT NULL,
+  `revoked` tinyint(1) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_group_invite_deleted_at` (`deleted_at`),
+  KEY `idx_group_invite_community_id` (`community_id`),
+  UNIQUE KEY `idx_group_invite_code` (`code`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `group_ban` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  `deleted_at` datetime(3) DEFAULT NULL,
+  `community_id` bigint(20) unsigned DEFAULT NULL,
+  `user_id` bigint(20) unsigned DEFAULT NULL,
+  `operator_id` bigint(20) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_group_ban_deleted_at` (`deleted_at`),
+  KEY `idx_group_ban_community_id` (`community_id`),
+  KEY `idx_group_ban_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `group_announcement` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  `deleted_at` datetime(3) DEFAULT NULL,
+  `community_id` bigint(20) unsigned DEFAULT NULL,
+  `author_id` bigint(20) unsigned DEFAULT NULL,
+  `title` longtext,
+  `content` longtext,
+  `editor_id` bigint(20) unsigned DEFAULT NULL,
+  `edit_time` bigint(20) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_group_announcement_deleted_at` (`deleted_at`),
+  KEY `idx_group_announcement_community_id` (`community_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `group_announcement_edit` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `announcement_id` bigint(20) unsigned DEFAULT NULL,
+  `editor_id` bigint(20) unsigned DEFAULT NULL,
+  `title` longtext,
+  `content` longtext,
+  `edit_time` bigint(20) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_group_announcement_edit_announcement_id` (`announcement_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `group_announcement_read` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `announcement_id` bigint(20) unsigned DEFAULT NULL,
+  `user_id` bigint(20) unsigned DEFAULT NULL,
+  `read_time` bigint(20) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_announcement_read` (`announcement_id`,`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-
+CREATE TABLE `group_pin` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `community_id` bigint(20) unsigned DEFAULT NULL,
+  `msg_id` bigint(20) unsigned DEFAULT NULL,
+  `operator_id` bigint(20) unsigned DEFAULT NULL,
+  `pin_time` bigint(20) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_group_pin` (`community_id`,`msg_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
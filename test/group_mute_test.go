@@ -0,0 +1,40 @@
+package mq
+
+import (
+	"simple-chatroom/models"
+	"testing"
+	"time"
+)
+
+// TestCheckGroupMute 测试全员禁言和个人禁言的发言校验
+func TestCheckGroupMute(t *testing.T) {
+	future := time.Now().Add(10 * time.Minute).Unix()
+	past := time.Now().Add(-10 * time.Minute).Unix()
+	cases := []struct {
+		name       string
+		role       int
+		muteUntil  int64
+		adminsOnly bool
+		code       string
+	}{
+		{"普通成员", models.RoleMember, 0, false, ""},
+		{"成员禁言中", models.RoleMember, future, false, models.ErrMuted.Code},
+		{"成员禁言已过期", models.RoleMember, past, false, ""},
+		{"全员禁言时成员", models.RoleMember, 0, true, models.ErrAdminsOnly.Code},
+		{"全员禁言时管理员", models.RoleAdmin, 0, true, ""},
+		{"群主禁言管理员", models.RoleAdmin, future, false, models.ErrMuted.Code},
+		{"全员禁言时被禁言的管理员", models.RoleAdmin, future, true, models.ErrMuted.Code},
+	}
+	for _, c := range cases {
+		contact := &models.Contact{MuteUntil: c.muteUntil}
+		community := &models.Community{AdminsOnly: c.adminsOnly}
+		err := models.CheckGroupMute(contact, c.role, community)
+		code := ""
+		if err != nil {
+			code = err.(*models.ChatError).Code
+		}
+		if code != c.code {
+			t.Errorf("%s: CheckGroupMute = %q; want %q", c.name, code, c.code)
+		}
+	}
+}
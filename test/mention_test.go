@@ -0,0 +1,29 @@
+package mq
+
+import (
+	"reflect"
+	"simple-chatroom/models"
+	"testing"
+)
+
+// TestParseMentions 测试解析消息中的@用户名
+func TestParseMentions(t *testing.T) {
+	cases := []struct {
+		content string
+		names   []string
+		all     bool
+	}{
+		{"大家好", []string{}, false},
+		{"@张三 明天开会", []string{"张三"}, false},
+		{"@all 通知一下 @李四@王五 @李四", []string{"李四", "王五"}, true},
+		{"@张三　明天开会 @李四，收到", []string{"张三", "李四"}, false},
+		{"请@王五。@赵六、@钱七：看一下", []string{"王五", "赵六", "钱七"}, false},
+		{"@tom_lee-2, ok", []string{"tom_lee-2"}, false},
+	}
+	for _, c := range cases {
+		names, all := models.ParseMentions(c.content)
+		if !reflect.DeepEqual(names, c.names) || all != c.all {
+			t.Errorf("ParseMentions(%q) = %v, %v; want %v, %v", c.content, names, all, c.names, c.all)
+		}
+	}
+}
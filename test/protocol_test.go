@@ -0,0 +1,66 @@
+package mq
+
+import (
+	"encoding/json"
+	"simple-chatroom/models"
+	"testing"
+)
+
+// TestParseFrame 测试解析信封格式和旧格式的客户端帧
+func TestParseFrame(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		env     bool
+		op      string
+		content string
+		err     error
+	}{
+		{"旧格式", `{"TargetId":2,"Type":1,"Media":1,"Content":"你好"}`, false, "", "你好", nil},
+		{"信封格式", `{"v":1,"op":"send","id":"c1","payload":{"TargetId":2,"Type":1,"Content":"hi"}}`, true, models.OpSend, "hi", nil},
+		{"信封缺少内容", `{"v":1,"op":"send","id":"c2"}`, true, models.OpSend, "", models.ErrBadFrame},
+		{"不支持的操作", `{"v":1,"op":"ack","id":"c3","payload":{}}`, true, models.OpAck, "", models.ErrBadFrame},
+	}
+	for _, c := range cases {
+		env, msg, err := models.ParseFrame([]byte(c.data))
+		if err != c.err {
+			t.Errorf("%s: err = %v; want %v", c.name, err, c.err)
+		}
+		if (env != nil) != c.env {
+			t.Errorf("%s: envelope = %v; want %v", c.name, env != nil, c.env)
+			continue
+		}
+		if env != nil && env.Op != c.op {
+			t.Errorf("%s: op = %q; want %q", c.name, env.Op, c.op)
+		}
+		if msg.Content != c.content {
+			t.Errorf("%s: content = %q; want %q", c.name, msg.Content, c.content)
+		}
+	}
+
+	if _, _, err := models.ParseFrame([]byte(`not json`)); err == nil {
+		t.Error("非法JSON应返回错误")
+	}
+}
+
+// TestWrapPush 测试把推送包装成信封
+func TestWrapPush(t *testing.T) {
+	data := []byte(`{"UserId":1,"TargetId":2,"Type":1,"Content":"hi","Seq":7}`)
+	env := models.Envelope{}
+	if err := json.Unmarshal(models.WrapPush(data), &env); err != nil {
+		t.Fatalf("解析信封失败: %v", err)
+	}
+	if env.V != models.ProtocolVersion || env.Op != models.OpPush || env.Seq != 7 {
+		t.Errorf("信封 = %+v; want v=%d op=%s seq=7", env, models.ProtocolVersion, models.OpPush)
+	}
+	msg := models.Message{}
+	if err := json.Unmarshal(env.Payload, &msg); err != nil || msg.Content != "hi" {
+		t.Errorf("payload = %s; want 原始消息", env.Payload)
+	}
+
+	// 已经是信封的原样返回
+	wrapped := []byte(`{"v":1,"op":"push","seq":3,"payload":{}}`)
+	if got := models.WrapPush(wrapped); string(got) != string(wrapped) {
+		t.Errorf("WrapPush(信封) = %s; want 原样返回", got)
+	}
+}
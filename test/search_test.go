@@ -0,0 +1,20 @@
+package mq
+
+import (
+	"simple-chatroom/models"
+	"testing"
+)
+
+// TestHighlightSnippet 测试搜索摘要高亮
+func TestHighlightSnippet(t *testing.T) {
+	got := models.HighlightSnippet("今天下午三点开会，记得带上<电脑>", "开会", 3)
+	want := "...午三点<em>开会</em>，记得..."
+	if got != want {
+		t.Errorf("HighlightSnippet = %q; want %q", got, want)
+	}
+	got = models.HighlightSnippet("Hello <b>World</b>", "world", 20)
+	want = "Hello &lt;b&gt;<em>World</em>&lt;/b&gt;"
+	if got != want {
+		t.Errorf("HighlightSnippet = %q; want %q", got, want)
+	}
+}
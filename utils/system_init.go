@@ -87,3 +87,10 @@ func Subscribe(ctx context.Context, channel string) (string, error) {
 	fmt.Println("Subscribe 。。。。", msg.Payload)
 	return msg.Payload, err
 }
+
+// SubscribeChannel 持续订阅Redis频道，返回消息通道
+func SubscribeChannel(ctx context.Context, channel string) <-chan *redis.Message {
+	sub := Red.Subscribe(ctx, channel)
+	fmt.Println("Subscribe 。。。。", channel)
+	return sub.Channel()
+}